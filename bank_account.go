@@ -34,16 +34,26 @@ type BankAccount struct {
 	AuthorizedBalanceCents int     `json:"authorized_balance_cents"`
 }
 
+// BalanceMoney returns account balance as Money
+func (b BankAccount) BalanceMoney() Money {
+	return NewMoney(int64(b.BalanceCents), b.Currency)
+}
+
+// AuthorizedBalanceMoney returns account authorized balance as Money
+func (b BankAccount) AuthorizedBalanceMoney() Money {
+	return NewMoney(int64(b.AuthorizedBalanceCents), b.Currency)
+}
+
 // String is a stringer for bankAccount stuct
 func (b *BankAccount) String() string {
 	return fmt.Sprintf(`
 		Slug: %s
 		IBAN: %s
 		BIC: %s
-		Current: %s
-		Balance (€): %f
+		Currency: %s
+		Balance: %s
 		Balance (cents): %d
-		Authorized Balance (€): %f
+		Authorized Balance: %s
 		Auhorized Balance (cents): %d
-		`, b.Slug, b.Iban, b.Bic, b.Currency, b.Balance, b.BalanceCents, b.AuthorizedBalance, b.AuthorizedBalanceCents)
+		`, b.Slug, b.Iban, b.Bic, b.Currency, b.BalanceMoney(), b.BalanceCents, b.AuthorizedBalanceMoney(), b.AuthorizedBalanceCents)
 }
@@ -0,0 +1,311 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// camt.053.001.02 namespace
+	camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+	// ISO dates and times
+	camtDateFormat     = "2006-01-02"
+	camtDateTimeFormat = "2006-01-02T15:04:05"
+	// max length of ISO 20022 texts (Max35Text, Max140Text, Max500Text)
+	camtMax35  = 35
+	camtMax140 = 140
+	camtMax500 = 500
+)
+
+// camt.053.001.02 elements, in the order of the XML schema
+
+type camtDocument struct {
+	XMLName xml.Name      `xml:"Document"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Stmt    camtBkToCstmr `xml:"BkToCstmrStmt"`
+}
+
+type camtBkToCstmr struct {
+	GrpHdr camtGrpHdr `xml:"GrpHdr"`
+	Stmt   camtStmt   `xml:"Stmt"`
+}
+
+type camtGrpHdr struct {
+	MsgID    string `xml:"MsgId"`
+	CreDtTm  string `xml:"CreDtTm"`
+	AddtlInf string `xml:"AddtlInf,omitempty"`
+}
+
+type camtStmt struct {
+	ID        string         `xml:"Id"`
+	CreDtTm   string         `xml:"CreDtTm"`
+	FrToDt    camtFrToDt     `xml:"FrToDt"`
+	Acct      camtAcct       `xml:"Acct"`
+	Bal       []camtBal      `xml:"Bal"`
+	TxsSummry *camtTxsSummry `xml:"TxsSummry,omitempty"`
+	Ntry      []camtNtry     `xml:"Ntry"`
+}
+
+type camtFrToDt struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type camtAcct struct {
+	IBAN string    `xml:"Id>IBAN"`
+	Ccy  string    `xml:"Ccy"`
+	Svcr *camtSvcr `xml:"Svcr,omitempty"`
+}
+
+type camtSvcr struct {
+	BIC string `xml:"FinInstnId>BIC"`
+}
+
+type camtAmt struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBal struct {
+	Cd        string  `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmt `xml:"Amt"`
+	CdtDbtInd string  `xml:"CdtDbtInd"`
+	Dt        string  `xml:"Dt>Dt"`
+}
+
+type camtTxsSummry struct {
+	TtlNtries    camtTtlNtries `xml:"TtlNtries"`
+	TtlCdtNtries camtNbAndSum  `xml:"TtlCdtNtries"`
+	TtlDbtNtries camtNbAndSum  `xml:"TtlDbtNtries"`
+}
+
+type camtTtlNtries struct {
+	NbOfNtries    int    `xml:"NbOfNtries"`
+	Sum           string `xml:"Sum"`
+	TtlNetNtryAmt string `xml:"TtlNetNtryAmt"`
+	CdtDbtInd     string `xml:"CdtDbtInd"`
+}
+
+type camtNbAndSum struct {
+	NbOfNtries int    `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+type camtNtry struct {
+	Amt          camtAmt    `xml:"Amt"`
+	CdtDbtInd    string     `xml:"CdtDbtInd"`
+	Sts          string     `xml:"Sts"`
+	BookgDt      string     `xml:"BookgDt>Dt"`
+	ValDt        *camtDate  `xml:"ValDt,omitempty"`
+	AcctSvcrRef  string     `xml:"AcctSvcrRef"`
+	BkTxCd       camtBkTxCd `xml:"BkTxCd"`
+	NtryDtls     camtTxDtls `xml:"NtryDtls>TxDtls"`
+	AddtlNtryInf string     `xml:"AddtlNtryInf,omitempty"`
+}
+
+type camtDate struct {
+	Dt string `xml:"Dt"`
+}
+
+type camtBkTxCd struct {
+	Cd   string `xml:"Prtry>Cd"`
+	Issr string `xml:"Prtry>Issr"`
+}
+
+type camtTxDtls struct {
+	AcctSvcrRef string   `xml:"Refs>AcctSvcrRef"`
+	Ustrd       []string `xml:"RmtInf>Ustrd,omitempty"`
+}
+
+// WriteCamt053 writes statement as an ISO 20022 camt.053.001.02 document
+// (bank to customer statement)
+// Completed transactions are booked entries (BOOK), pending ones are
+// pending entries (PDNG), declined and reversed transactions are not
+// written. CdtDbtInd of entries is CRDT or DBIT according to
+// Transaction.Side, the bank transaction code is the operation type
+// (proprietary code issued by QONTO) and the account servicer reference is
+// the transaction ID (its last 35 characters if longer). Opening (OPBD) and
+// closing (CLBD) balances are computed from the statement, the
+// transactions summary (TxsSummry) covers booked entries only.
+// Dates are in the location of statement.From.
+func WriteCamt053(w io.Writer, statement Statement, messageID string) error {
+	doc, err := camt053Document(statement, messageID)
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err = encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// camt053Document returns the camt.053 document of statement
+func camt053Document(statement Statement, messageID string) (*camtDocument, error) {
+	loc := statement.From.Location()
+	date := func(t time.Time) string {
+		return t.In(loc).Format(camtDateFormat)
+	}
+	dateTime := func(t time.Time) string {
+		return t.In(loc).Format(camtDateTimeFormat)
+	}
+	createdAt := statement.createdAt()
+	currency := statement.Currency()
+	if messageID == "" {
+		messageID = "QONTO-" + createdAt.UTC().Format("20060102150405")
+	}
+
+	stmt := camtStmt{
+		ID:      truncate(date(statement.From)+"-"+date(statement.To), camtMax35),
+		CreDtTm: dateTime(createdAt),
+		FrToDt:  camtFrToDt{FrDtTm: dateTime(statement.From), ToDtTm: dateTime(statement.To)},
+		Acct:    camtAcct{IBAN: compactIBAN(statement.Account.Iban), Ccy: currency},
+	}
+	if statement.Account.Bic != "" {
+		stmt.Acct.Svcr = &camtSvcr{BIC: strings.ToUpper(statement.Account.Bic)}
+	}
+
+	opening, err := statement.Opening()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Bal = []camtBal{
+		camtBalance("OPBD", opening, date(statement.From)),
+		camtBalance("CLBD", statement.Closing(), date(statement.To)),
+	}
+
+	summary := &camtTxsSummry{}
+	credits, debits := NewMoney(0, currency), NewMoney(0, currency)
+	for _, t := range statement.Transactions {
+		var status string
+		switch {
+		case t.Status.IsSettled():
+			status = "BOOK"
+		case t.Status.IsPending():
+			status = "PDNG"
+		default:
+			continue
+		}
+		amount := t.Money()
+		if !strings.EqualFold(amount.Currency, currency) {
+			return nil, fmt.Errorf("transaction %s: currency %s doesn't match statement currency %s", t.ID, amount.Currency, currency)
+		}
+		ntry := camtNtry{
+			Amt:         camtAmt{Ccy: amount.Currency, Value: amount.Abs().Decimal()},
+			CdtDbtInd:   "CRDT",
+			Sts:         status,
+			BookgDt:     date(bookingDate(t)),
+			AcctSvcrRef: camtReference(t.ID),
+			BkTxCd:      camtBkTxCd{Cd: truncate(string(t.OperationType), camtMax35), Issr: "QONTO"},
+			NtryDtls:    camtTxDtls{AcctSvcrRef: camtReference(t.ID)},
+		}
+		if t.SettleAt.Valid() {
+			ntry.ValDt = &camtDate{Dt: date(t.SettleAt.Time)}
+		}
+		if t.Side.IsDebit() {
+			ntry.CdtDbtInd = "DBIT"
+		}
+		// totals are those of booked entries, so opening balance plus net
+		// amount is the closing balance
+		switch {
+		case status != "BOOK":
+		case t.Side.IsDebit():
+			if debits, err = debits.Add(amount); err != nil {
+				return nil, err
+			}
+			summary.TtlDbtNtries.NbOfNtries++
+		default:
+			if credits, err = credits.Add(amount); err != nil {
+				return nil, err
+			}
+			summary.TtlCdtNtries.NbOfNtries++
+		}
+		if label := strings.Join(strings.Fields(t.Label), " "); label != "" {
+			ntry.NtryDtls.Ustrd = []string{truncate(label, camtMax140)}
+		}
+		var info []string
+		for _, value := range []string{t.Label, t.Note} {
+			if value = strings.Join(strings.Fields(value), " "); value != "" {
+				info = append(info, value)
+			}
+		}
+		ntry.AddtlNtryInf = truncate(strings.Join(info, " - "), camtMax500)
+		stmt.Ntry = append(stmt.Ntry, ntry)
+	}
+
+	total, _ := credits.Add(debits)
+	net, _ := credits.Sub(debits)
+	summary.TtlNtries = camtTtlNtries{
+		NbOfNtries:    summary.TtlCdtNtries.NbOfNtries + summary.TtlDbtNtries.NbOfNtries,
+		Sum:           total.Decimal(),
+		TtlNetNtryAmt: net.Abs().Decimal(),
+		CdtDbtInd:     camtCdtDbtInd(net),
+	}
+	summary.TtlCdtNtries.Sum = credits.Decimal()
+	summary.TtlDbtNtries.Sum = debits.Decimal()
+	stmt.TxsSummry = summary
+
+	return &camtDocument{
+		Xmlns: camt053Namespace,
+		Stmt: camtBkToCstmr{
+			GrpHdr: camtGrpHdr{MsgID: truncate(messageID, camtMax35), CreDtTm: dateTime(createdAt)},
+			Stmt:   stmt,
+		},
+	}, nil
+}
+
+// camtBalance returns a balance of type code
+func camtBalance(code string, balance Money, date string) camtBal {
+	return camtBal{
+		Cd:        code,
+		Amt:       camtAmt{Ccy: balance.Currency, Value: balance.Abs().Decimal()},
+		CdtDbtInd: camtCdtDbtInd(balance),
+		Dt:        date,
+	}
+}
+
+// camtCdtDbtInd returns DBIT for negative amounts, CRDT otherwise
+func camtCdtDbtInd(m Money) string {
+	if m.IsNegative() {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+// camtReference returns the last 35 characters of id (Max35Text), the end
+// of Qonto transaction IDs is the unique part
+func camtReference(id string) string {
+	runes := []rune(id)
+	if len(runes) <= camtMax35 {
+		return id
+	}
+	return string(runes[len(runes)-camtMax35:])
+}
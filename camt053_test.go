@@ -0,0 +1,193 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// camtChildren returns names of children of the first element named parent
+func camtChildren(t *testing.T, doc []byte, parent string) (names []string) {
+	decoder := xml.NewDecoder(bytes.NewReader(doc))
+	depth := -1
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		switch e := token.(type) {
+		case xml.StartElement:
+			if depth >= 0 {
+				depth++
+				if depth == 1 {
+					names = append(names, e.Name.Local)
+				}
+			} else if e.Name.Local == parent {
+				depth = 0
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				return
+			}
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+}
+
+func TestCamt053(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, WriteCamt053(&out, testStatement(), "MSG-1"))
+	doc := out.Bytes()
+
+	var camt camtDocument
+	assert.NoError(t, xml.Unmarshal(doc, &camt))
+	assert.Equal(t, camt053Namespace, camt.Xmlns)
+	assert.Equal(t, "MSG-1", camt.Stmt.GrpHdr.MsgID)
+	assert.Equal(t, "2018-02-01T08:00:00", camt.Stmt.GrpHdr.CreDtTm)
+	stmt := camt.Stmt.Stmt
+	assert.Equal(t, "2018-01-01-2018-01-31", stmt.ID)
+	assert.Equal(t, camtFrToDt{FrDtTm: "2018-01-01T00:00:00", ToDtTm: "2018-01-31T23:59:59"}, stmt.FrToDt)
+	assert.Equal(t, "FR7616958000011234567890123", stmt.Acct.IBAN)
+	assert.Equal(t, "EUR", stmt.Acct.Ccy)
+	assert.Equal(t, "QNTOFRP1XXX", stmt.Acct.Svcr.BIC)
+	// opening: 1000.00 + 1234.50 - 5000.00
+	assert.Equal(t, []camtBal{
+		{Cd: "OPBD", Amt: camtAmt{Ccy: "EUR", Value: "2765.50"}, CdtDbtInd: "DBIT", Dt: "2018-01-01"},
+		{Cd: "CLBD", Amt: camtAmt{Ccy: "EUR", Value: "1000.00"}, CdtDbtInd: "CRDT", Dt: "2018-01-31"},
+	}, stmt.Bal)
+	// booked entries only: opening + net = closing
+	assert.Equal(t, camtTtlNtries{NbOfNtries: 2, Sum: "6234.50", TtlNetNtryAmt: "3765.50", CdtDbtInd: "CRDT"}, stmt.TxsSummry.TtlNtries)
+	assert.Equal(t, camtNbAndSum{NbOfNtries: 1, Sum: "5000.00"}, stmt.TxsSummry.TtlCdtNtries)
+	assert.Equal(t, camtNbAndSum{NbOfNtries: 1, Sum: "1234.50"}, stmt.TxsSummry.TtlDbtNtries)
+	if assert.Len(t, stmt.Ntry, 3) {
+		ntry := stmt.Ntry[0]
+		assert.Equal(t, camtAmt{Ccy: "EUR", Value: "1234.50"}, ntry.Amt)
+		assert.Equal(t, "DBIT", ntry.CdtDbtInd)
+		assert.Equal(t, "BOOK", ntry.Sts)
+		assert.Equal(t, "2018-01-18", ntry.BookgDt)
+		assert.Equal(t, &camtDate{Dt: "2018-01-18"}, ntry.ValDt)
+		assert.Equal(t, "t1", ntry.AcctSvcrRef)
+		assert.Equal(t, camtBkTxCd{Cd: "card", Issr: "QONTO"}, ntry.BkTxCd)
+		assert.Equal(t, []string{"Hotel & Spa <New York> - Fifth Avenue"}, ntry.NtryDtls.Ustrd)
+		assert.Equal(t, "Hotel & Spa <New York> - Fifth Avenue - trip", ntry.AddtlNtryInf)
+		assert.Equal(t, "CRDT", stmt.Ntry[1].CdtDbtInd)
+		// pending
+		assert.Equal(t, "PDNG", stmt.Ntry[2].Sts)
+		assert.Equal(t, "2018-01-17", stmt.Ntry[2].BookgDt)
+		assert.Nil(t, stmt.Ntry[2].ValDt)
+	}
+
+	// elements order and types of the camt.053.001.02 schema
+	assert.Equal(t, []string{"GrpHdr", "Stmt"}, camtChildren(t, doc, "BkToCstmrStmt"))
+	assert.Equal(t, []string{"MsgId", "CreDtTm"}, camtChildren(t, doc, "GrpHdr"))
+	assert.Equal(t, []string{"Id", "CreDtTm", "FrToDt", "Acct", "Bal", "Bal", "TxsSummry", "Ntry", "Ntry", "Ntry"}, camtChildren(t, doc, "Stmt"))
+	assert.Equal(t, []string{"Id", "Ccy", "Svcr"}, camtChildren(t, doc, "Acct"))
+	assert.Equal(t, []string{"Tp", "Amt", "CdtDbtInd", "Dt"}, camtChildren(t, doc, "Bal"))
+	assert.Equal(t, []string{"TtlNtries", "TtlCdtNtries", "TtlDbtNtries"}, camtChildren(t, doc, "TxsSummry"))
+	assert.Equal(t, []string{"NbOfNtries", "Sum", "TtlNetNtryAmt", "CdtDbtInd"}, camtChildren(t, doc, "TtlNtries"))
+	assert.Equal(t, []string{"Amt", "CdtDbtInd", "Sts", "BookgDt", "ValDt", "AcctSvcrRef", "BkTxCd", "NtryDtls", "AddtlNtryInf"}, camtChildren(t, doc, "Ntry"))
+	assert.Equal(t, []string{"Refs", "RmtInf"}, camtChildren(t, doc, "TxDtls"))
+	iban := regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[a-zA-Z0-9]{1,30}$`)
+	bic := regexp.MustCompile(`^[A-Z]{6}[A-Z2-9][A-NP-Z0-9]([A-Z0-9]{3})?$`)
+	amount := regexp.MustCompile(`^[0-9]{1,13}(\.[0-9]{1,5})?$`)
+	assert.Regexp(t, iban, stmt.Acct.IBAN)
+	assert.Regexp(t, bic, stmt.Acct.Svcr.BIC)
+	for _, ntry := range stmt.Ntry {
+		assert.Regexp(t, amount, ntry.Amt.Value)
+		assert.True(t, len(ntry.AcctSvcrRef) <= camtMax35)
+	}
+
+	// long IDs are truncated to their unique end
+	assert.Equal(t, "-account-1-transaction-123456789012", camtReference("my-orga-42-bank-account-1-transaction-123456789012"))
+
+	// currency mismatch
+	statement := testStatement()
+	statement.Transactions[0].Currency = "USD"
+	assert.Error(t, WriteCamt053(&out, statement, ""))
+}
+
+// TestCamt053Golden compares a generated document with
+// testdata/camt053.golden.xml, validated against the camt.053.001.02 schema
+// by TestCamt053Schema
+func TestCamt053Golden(t *testing.T) {
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "camt053.golden.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	assert.NoError(t, WriteCamt053(&out, testStatement(), "MSG-1"))
+	assert.Equal(t, string(golden), out.String())
+}
+
+// TestCamt053Schema validates the golden document and generated documents
+// against the camt.053.001.02 XML schema with xmllint. The schema is
+// CAMT053_XSD if set, else the official testdata/camt.053.001.02.xsd from
+// https://www.iso20022.org, else testdata/camt.053.001.02.subset.xsd
+// (elements written by WriteCamt053).
+func TestCamt053Schema(t *testing.T) {
+	xsd := os.Getenv("CAMT053_XSD")
+	if xsd == "" {
+		xsd = filepath.Join("testdata", "camt.053.001.02.xsd")
+		if _, err := os.Stat(xsd); err != nil {
+			xsd = filepath.Join("testdata", "camt.053.001.02.subset.xsd")
+		}
+	}
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not found")
+	}
+	dir := t.TempDir()
+
+	// long IDs and labels, no BIC, empty statement
+	long := testStatement()
+	long.Account.Bic = ""
+	long.Transactions[0].ID = "my-orga-42-bank-account-1-transaction-123456789012"
+	long.Transactions[0].Label = strings.Repeat("label ", 40)
+	long.Transactions[0].Note = strings.Repeat("note ", 120)
+	empty := testStatement()
+	empty.Transactions = nil
+
+	paths := []string{filepath.Join("testdata", "camt053.golden.xml")}
+	for i, statement := range []Statement{long, empty} {
+		var out bytes.Buffer
+		assert.NoError(t, WriteCamt053(&out, statement, strings.Repeat("M", 40)))
+		path := filepath.Join(dir, fmt.Sprintf("statement-%d.xml", i))
+		assert.NoError(t, ioutil.WriteFile(path, out.Bytes(), 0600))
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		result, err := exec.Command(xmllint, "--noout", "--schema", xsd, path).CombinedOutput()
+		assert.NoError(t, err, string(result))
+	}
+}
@@ -21,12 +21,13 @@
 package qonto
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -35,30 +36,96 @@ const (
 	endpoint = "https://thirdparty.qonto.eu/v2"
 	// client timeout in seconds
 	clientTimeout = 15
+	// default User-Agent header
+	userAgent = "go-qonto"
 )
 
 // Client is the client to interact with Qonto REST API
 type Client struct {
-	client   *http.Client
-	login    string
-	secret   string
-	endpoint string
+	client    *http.Client
+	login     string
+	secret    string
+	endpoint  string
+	userAgent string
+	retry     *RetryPolicy
+	limiter   *RateLimiter
+}
+
+// Option is a functional option for New
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used to do requests
+// The client is copied, so options applied after this one (WithTimeout,
+// WithTransport) don't modify it.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		if httpClient == nil {
+			return
+		}
+		clone := *httpClient
+		c.client = &clone
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to do requests
+// (proxies, mTLS, tracing,...)
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.client.Transport = transport
+	}
+}
+
+// WithEndpoint sets the base URL of the API (sandbox, local stand-in,...)
+func WithEndpoint(baseURL string) Option {
+	return func(c *Client) {
+		c.endpoint = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithTimeout sets the timeout of requests, 0 means no timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.client.Timeout = timeout
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with each request
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
 }
 
 // New returns a Qonto client
-func New(login, secret string) (qonto Client) {
+// By default the client uses the production endpoint and a 15 seconds timeout
+func New(login, secret string, options ...Option) (qonto Client) {
 	qonto.client = new(http.Client)
 	qonto.client.Timeout = clientTimeout * time.Second
 	qonto.login = login
 	qonto.secret = secret
 	qonto.endpoint = endpoint
+	qonto.userAgent = userAgent
+	for _, option := range options {
+		option(&qonto)
+	}
 	return
 }
 
+// newRequest returns a new http.Request bound to ctx for the given API path
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, method, c.endpoint+path, body)
+}
+
 // do is a wrapper for http.client.Do wich add authentification
+// request context is honored: if it's canceled or its deadline is exceeded
+// the call is aborted. Failed idempotent requests are retried according to
+// the client retry policy (see WithRetryPolicy).
 func (c *Client) do(req *http.Request) (*http.Response, error) {
 	req.Header.Add("Authorization", c.login+":"+c.secret)
-	return c.client.Do(req)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	return c.doWithRetry(req)
 }
 
 // doAndReturnBody is a http.Client.Do wrapper with auth which returns response body as bytes slice
@@ -68,15 +135,21 @@ func (c *Client) doAndReturnBody(req *http.Request) (body []byte, err error) {
 		return body, err
 	}
 	defer response.Body.Close()
+	body, err = ioutil.ReadAll(response.Body)
 	if response.StatusCode != http.StatusOK {
-		return body, fmt.Errorf("request failed - bad HTTP status returned: %s", response.Status)
+		return nil, newAPIError(response, body)
 	}
-	return ioutil.ReadAll(response.Body)
+	return body, err
 }
 
 // GetOrganization is a wrapper that handle GET /organizations/{login} call
 func (c *Client) GetOrganization(organizationName string) (organization Organization, err error) {
-	req, err := http.NewRequest("GET", c.endpoint+"/organizations/"+url.QueryEscape(organizationName), nil)
+	return c.GetOrganizationContext(context.Background(), organizationName)
+}
+
+// GetOrganizationContext is like GetOrganization with a context
+func (c *Client) GetOrganizationContext(ctx context.Context, organizationName string) (organization Organization, err error) {
+	req, err := c.newRequest(ctx, "GET", "/organizations/"+url.QueryEscape(organizationName), nil)
 	if err != nil {
 		return
 	}
@@ -90,24 +163,70 @@ func (c *Client) GetOrganization(organizationName string) (organization Organiza
 }
 
 // GetTransactions is a wrapper that handle GET /transaction call
+// It only returns the page requested in options, use ListAllTransactions
+// to walk through all pages.
 func (c *Client) GetTransactions(options GetTransactionOptions) (transactions []Transaction, err error) {
+	return c.GetTransactionsContext(context.Background(), options)
+}
+
+// GetTransactionsContext is like GetTransactions with a context
+func (c *Client) GetTransactionsContext(ctx context.Context, options GetTransactionOptions) (transactions []Transaction, err error) {
+	transactions, _, err = c.GetTransactionsPageContext(ctx, options)
+	return
+}
+
+// GetTransactionsPage is a wrapper that handle GET /transaction call and
+// returns transactions along with pagination metadata
+func (c *Client) GetTransactionsPage(options GetTransactionOptions) (transactions []Transaction, meta TransactionsMeta, err error) {
+	return c.GetTransactionsPageContext(context.Background(), options)
+}
+
+// GetTransactionsPageContext is like GetTransactionsPage with a context
+func (c *Client) GetTransactionsPageContext(ctx context.Context, options GetTransactionOptions) (transactions []Transaction, meta TransactionsMeta, err error) {
 	// validate options
 	if valid, err := options.isValid(); !valid {
-		return transactions, err
+		return transactions, meta, err
 	}
 
-	payload := bytes.NewBuffer([]byte("{pending, reversed, declined, completed}"))
-
-	req, err := http.NewRequest("GET", c.endpoint+"/transactions?slug="+url.QueryEscape(options.Slug)+"&iban="+url.QueryEscape(options.Iban), payload)
+	req, err := c.newRequest(ctx, "GET", "/transactions?"+options.values().Encode(), nil)
 	if err != nil {
 		return
 	}
 
 	resp, err := c.doAndReturnBody(req)
 	if err != nil {
-		return transactions, err
+		return transactions, meta, err
 	}
 	response := new(getTransactionResponse)
 	err = json.Unmarshal(resp, response)
-	return response.Transactions, err
+	return response.Transactions, response.Meta, err
+}
+
+// ListAllTransactions follows next_page until all transactions matching
+// options are fetched. callback is called once per page, if it returns an
+// error, pagination stops and this error is returned.
+// options.CurrentPage is used as starting page (first page if not set).
+func (c *Client) ListAllTransactions(options GetTransactionOptions, callback func(transactions []Transaction, meta TransactionsMeta) error) error {
+	return c.ListAllTransactionsContext(context.Background(), options, callback)
+}
+
+// ListAllTransactionsContext is like ListAllTransactions with a context
+// Pagination stops as soon as ctx is done.
+func (c *Client) ListAllTransactionsContext(ctx context.Context, options GetTransactionOptions, callback func(transactions []Transaction, meta TransactionsMeta) error) error {
+	for {
+		transactions, meta, err := c.GetTransactionsPageContext(ctx, options)
+		if err != nil {
+			return err
+		}
+		if err = callback(transactions, meta); err != nil {
+			return err
+		}
+		if !meta.HasNextPage() || meta.NextPage <= meta.CurrentPage {
+			return nil
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		options.CurrentPage = meta.NextPage
+	}
 }
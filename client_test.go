@@ -21,6 +21,8 @@
 package qonto
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -32,7 +34,7 @@ import (
 
 const (
 	getOrganizationResponse     = `{"organization":{"slug":"slug","bank_accounts":[{"slug":"bank-account-1","iban":"IBAN","bic":"BIC","currency":"EUR","balance":0.0,"balance_cents":0,"authorized_balance":0.0,"authorized_balance_cents":0}]}}`
-	getTransactionsResponse     = `{"transactions":[{"transaction_id":"bank-account-1-transaction-1","amount":100000000.0,"amount_cents":10000000000,"local_amount":100000000.0,"local_amount_cents":10000000000,"side":"credit","operation_type":"income","currency":"EUR","local_currency":"EUR","label":"Present from Elon Musk","settled_at":"2018-01-18T06:45:57.000Z","emitted_at":"2018-01-18T07:45:58.000Z","status":"completed","note":null}],"meta":{"current_page":1,"next_page":null,"prev_page":null,"total_pages":1,"total_count":1,"per_page":100}}`
+	getTransactionsResponse     = `{"transactions":[{"transaction_id":"bank-account-1-transaction-1","amount":100000000.0,"amount_cents":10000000000,"local_amount":100000000.0,"local_amount_cents":10000000000,"side":"credit","operation_type":"income","currency":"EUR","local_currency":"EUR","label":"Present from Elon Musk","settled_at":"2018-01-18T06:45:57.000Z","emitted_at":"2018-01-18T07:45:58.000Z","status":"completed","note":null},{"transaction_id":"bank-account-1-transaction-2","amount":10.0,"amount_cents":1000,"local_amount":10.0,"local_amount_cents":1000,"side":"debit","operation_type":"card","currency":"EUR","local_currency":"EUR","label":"Coffee","settled_at":null,"emitted_at":"2018-01-19T08:00:00Z","status":"pending","note":null}],"meta":{"current_page":1,"next_page":null,"prev_page":null,"total_pages":1,"total_count":2,"per_page":100}}`
 	testDoAndReturnBodyResponse = "yop"
 )
 
@@ -114,15 +116,15 @@ func TestGetTransaction(t *testing.T) {
 	}
 	transactions, err := Q.GetTransactions(options)
 	assert.NoError(t, err)
-	assert.Equal(t, 1, len(transactions))
+	assert.Equal(t, 2, len(transactions))
 	tx := transactions[0]
 	assert.Equal(t, "bank-account-1-transaction-1", tx.ID)
 	assert.Equal(t, 100000000.0, tx.Amount)
 	assert.Equal(t, uint64(10000000000), tx.AmountCents)
 	assert.Equal(t, 100000000.0, tx.LocalAmount)
 	assert.Equal(t, uint64(10000000000), tx.LocalAmountCents)
-	assert.Equal(t, "credit", tx.Side)
-	assert.Equal(t, "income", tx.OperationType)
+	assert.Equal(t, SideCredit, tx.Side)
+	assert.Equal(t, OperationTypeIncome, tx.OperationType)
 	assert.Equal(t, "EUR", tx.Currency)
 	assert.Equal(t, "EUR", tx.LocalCurrency)
 	assert.Equal(t, "Present from Elon Musk", tx.Label)
@@ -131,6 +133,279 @@ func TestGetTransaction(t *testing.T) {
 	assert.Equal(t, expectedT, tx.SettleAt.Time)
 	expectedT, _ = time.Parse(ISO8601, "2018-01-18T07:45:58.000Z")
 	assert.Equal(t, expectedT, tx.EmittedAt.Time)
-	assert.Equal(t, "completed", tx.Status)
+	assert.Equal(t, StatusCompleted, tx.Status)
 	assert.Equal(t, "", tx.Note)
+	// pending transaction (settled_at is null)
+	tx = transactions[1]
+	assert.Equal(t, StatusPending, tx.Status)
+	assert.False(t, tx.SettleAt.Valid())
+	assert.True(t, tx.EmittedAt.Valid())
+}
+
+func TestListAllTransactions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+		switch r.URL.Query().Get("current_page") {
+		case "", "1":
+			fmt.Fprintln(w, `{"transactions":[{"transaction_id":"tx-1"},{"transaction_id":"tx-2"}],"meta":{"current_page":1,"next_page":2,"prev_page":null,"total_pages":2,"total_count":3,"per_page":2}}`)
+		case "2":
+			fmt.Fprintln(w, `{"transactions":[{"transaction_id":"tx-3"}],"meta":{"current_page":2,"next_page":null,"prev_page":1,"total_pages":2,"total_count":3,"per_page":2}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	Q := New("login", "secret")
+	Q.endpoint = ts.URL
+	options := GetTransactionOptions{
+		Slug:    "slug",
+		Iban:    "iban",
+		PerPage: 2,
+	}
+	var ids []string
+	var lastMeta TransactionsMeta
+	err := Q.ListAllTransactions(options, func(transactions []Transaction, meta TransactionsMeta) error {
+		for _, tx := range transactions {
+			ids = append(ids, tx.ID)
+		}
+		lastMeta = meta
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tx-1", "tx-2", "tx-3"}, ids)
+	assert.Equal(t, uint16(2), lastMeta.TotalPages)
+	assert.Equal(t, uint32(3), lastMeta.TotalCount)
+	assert.False(t, lastMeta.HasNextPage())
+}
+
+// TestContextCanceled check that a canceled context aborts the call
+func TestContextCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, getOrganizationResponse)
+	}))
+	defer ts.Close()
+	Q := New("login", "secret")
+	Q.endpoint = ts.URL
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Q.GetOrganizationContext(ctx, "foo")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestOptions check that functional options are applied
+func TestOptions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "my-agent/1.0", r.Header.Get("User-Agent"))
+		assert.Equal(t, "/v2/organizations/foo", r.URL.Path)
+		fmt.Fprintln(w, getOrganizationResponse)
+	}))
+	defer ts.Close()
+
+	var called bool
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		called = true
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	httpClient := &http.Client{}
+	Q := New("login", "secret",
+		WithHTTPClient(httpClient),
+		WithTransport(transport),
+		WithTimeout(time.Second),
+		WithEndpoint(ts.URL+"/v2/"),
+		WithUserAgent("my-agent/1.0"),
+	)
+	orga, err := Q.GetOrganization("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "slug", orga.Slug)
+	assert.True(t, called)
+	// provided client must not be modified
+	assert.Nil(t, httpClient.Transport)
+	assert.Equal(t, time.Duration(0), httpClient.Timeout)
+}
+
+// TestAPIError check that error responses are returned as *APIError
+func TestAPIError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-42")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, `{"errors":[{"code":"not_found","detail":"organization not found"}]}`)
+	}))
+	defer ts.Close()
+	Q := New("login", "secret")
+	Q.endpoint = ts.URL
+	_, err := Q.GetOrganization("foo")
+	assert.EqualError(t, err, "request failed - bad HTTP status returned: 404 Not Found - not_found: organization not found (request id: req-42)")
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "req-42", apiErr.RequestID)
+	assert.Equal(t, []APIErrorMessage{{Code: "not_found", Detail: "organization not found"}}, apiErr.Errors)
+	assert.True(t, IsNotFound(err))
+	assert.False(t, IsUnauthorized(err))
+
+	// {"message": ..., "errors": {field: [...]}} format
+	messages := parseAPIErrorMessages([]byte(`{"message":"invalid parameters","errors":{"status":["is invalid"],"iban":["is missing"]}}`))
+	assert.Equal(t, []APIErrorMessage{
+		{Detail: "invalid parameters"},
+		{Code: "iban", Detail: "is missing"},
+		{Code: "status", Detail: "is invalid"},
+	}, messages)
+}
+
+// TestRetry check that transient errors are retried
+func TestRetry(t *testing.T) {
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprintln(w, getOrganizationResponse)
+		}
+	}))
+	defer ts.Close()
+	var events []RetryEvent
+	Q := New("login", "secret", WithEndpoint(ts.URL), WithRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+		OnRetry: func(event RetryEvent) {
+			events = append(events, event)
+		},
+	}))
+	orga, err := Q.GetOrganization("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "slug", orga.Slug)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, http.StatusTooManyRequests, events[0].StatusCode)
+	assert.Equal(t, time.Duration(0), events[0].Wait)
+	assert.Equal(t, http.StatusServiceUnavailable, events[1].StatusCode)
+
+	// max attempts reached
+	attempts = 0
+	ts503 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts503.Close()
+	Q.endpoint = ts503.URL
+	_, err = Q.GetOrganization("foo")
+	assert.True(t, hasStatus(err, http.StatusServiceUnavailable))
+	assert.Equal(t, 3, attempts)
+
+	// non idempotent requests are not retried
+	attempts = 0
+	req, _ := http.NewRequest("POST", ts503.URL, nil)
+	resp, err := Q.do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 1, attempts)
+}
+
+// TestRateLimiter check that calls are throttled
+func TestRetryBackoff(t *testing.T) {
+	// waits are between wait/2 and wait (jitter)
+	between := func(wait, min, max time.Duration) bool {
+		return wait >= min && wait <= max
+	}
+	policy := RetryPolicy{MinBackoff: 100 * time.Millisecond}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond} {
+		wait := policy.backoff(attempt, nil)
+		assert.True(t, between(wait, max/2, max), "attempt %d: %s", attempt, wait)
+	}
+	// no overflow
+	assert.True(t, policy.backoff(100, nil) > 0)
+
+	policy.MaxBackoff = 300 * time.Millisecond
+	wait := policy.backoff(4, nil)
+	assert.True(t, between(wait, 150*time.Millisecond, 300*time.Millisecond), wait.String())
+
+	// Retry-After wins
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"2"}}}
+	assert.Equal(t, 2*time.Second, policy.backoff(1, resp))
+}
+
+func TestRateLimiter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, getOrganizationResponse)
+	}))
+	defer ts.Close()
+	limiter := NewRateLimiter(20, 1)
+	Q := New("login", "secret", WithEndpoint(ts.URL), WithRateLimiter(limiter))
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := Q.GetOrganization("foo")
+		assert.NoError(t, err)
+	}
+	// first call uses the burst, then 2 x 50ms
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	// waiting honors context
+	limiter = NewRateLimiter(0.1, 1)
+	assert.NoError(t, limiter.Wait(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx))
+}
+
+// TestGetTransactionsQuery check that options are sent as query parameters
+func TestGetTransactionsQuery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal(t, "slug", query.Get("slug"))
+		assert.Equal(t, "iban", query.Get("iban"))
+		assert.Equal(t, []string{"pending", "completed"}, query["status[]"])
+		assert.Equal(t, "2018-01-01T00:00:00.000Z", query.Get("settled_at_from"))
+		assert.Equal(t, "2018-01-31T23:59:59.000Z", query.Get("settled_at_to"))
+		assert.Equal(t, "", query.Get("updated_at_from"))
+		assert.Equal(t, "debit", query.Get("side"))
+		assert.Equal(t, []string{"card", "qonto_fee"}, query["operation_type[]"])
+		assert.Equal(t, "settled_at:desc", query.Get("sort_by"))
+		assert.Equal(t, "3", query.Get("current_page"))
+		assert.Equal(t, "50", query.Get("per_page"))
+		fmt.Fprintln(w, getTransactionsResponse)
+	}))
+	defer ts.Close()
+	Q := New("login", "secret", WithEndpoint(ts.URL))
+	from, _ := time.Parse(ISO8601, "2018-01-01T00:00:00.000Z")
+	to, _ := time.Parse(ISO8601, "2018-01-31T23:59:59.000Z")
+	options := GetTransactionOptions{
+		Slug:          "slug",
+		Iban:          "iban",
+		Status:        []Status{StatusPending, StatusCompleted},
+		SettledAtFrom: from,
+		SettledAtTo:   to,
+		Side:          SideDebit,
+		OperationType: []OperationType{OperationTypeCard, OperationTypeQontoFee},
+		SortBy:        "settled_at:desc",
+		CurrentPage:   3,
+		PerPage:       50,
+	}
+	_, err := Q.GetTransactions(options)
+	assert.NoError(t, err)
+
+	// invalid enums
+	options.Status = []Status{"foo"}
+	_, err = Q.GetTransactions(options)
+	assert.EqualError(t, err, `parameter Status: invalid value "foo" (expected one of pending, reversed, declined, completed)`)
+	options.Status = nil
+	options.Side = "both"
+	_, err = Q.GetTransactions(options)
+	assert.Error(t, err)
+	options.Side = ""
+	options.SettledAtTo, options.SettledAtFrom = from, to
+	_, err = Q.GetTransactions(options)
+	assert.EqualError(t, err, "parameter SettledAtTo must be after SettledAtFrom")
 }
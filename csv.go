@@ -0,0 +1,261 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// CSVColumn is a column of transactions CSV exports
+type CSVColumn string
+
+// CSV columns
+const (
+	CSVColumnID            CSVColumn = "transaction_id"
+	CSVColumnEmittedAt     CSVColumn = "emitted_at"
+	CSVColumnSettledAt     CSVColumn = "settled_at"
+	CSVColumnStatus        CSVColumn = "status"
+	CSVColumnSide          CSVColumn = "side"
+	CSVColumnOperationType CSVColumn = "operation_type"
+	// CSVColumnAmount is the signed amount (negative for debits)
+	CSVColumnAmount   CSVColumn = "amount"
+	CSVColumnCurrency CSVColumn = "currency"
+	// CSVColumnDebit and CSVColumnCredit are the amount in the debit or in
+	// the credit column (the other one is empty), as in accounting books
+	CSVColumnDebit  CSVColumn = "debit"
+	CSVColumnCredit CSVColumn = "credit"
+	// CSVColumnLocalAmount is the signed local amount (negative for debits)
+	CSVColumnLocalAmount   CSVColumn = "local_amount"
+	CSVColumnLocalCurrency CSVColumn = "local_currency"
+	CSVColumnLabel         CSVColumn = "label"
+	CSVColumnNote          CSVColumn = "note"
+)
+
+// CSVColumns are all available CSV columns
+var CSVColumns = []CSVColumn{
+	CSVColumnID, CSVColumnEmittedAt, CSVColumnSettledAt, CSVColumnStatus, CSVColumnSide, CSVColumnOperationType,
+	CSVColumnAmount, CSVColumnCurrency, CSVColumnDebit, CSVColumnCredit, CSVColumnLocalAmount, CSVColumnLocalCurrency,
+	CSVColumnLabel, CSVColumnNote,
+}
+
+// DefaultCSVColumns are the columns written if CSVOptions.Columns is empty
+var DefaultCSVColumns = []CSVColumn{
+	CSVColumnID, CSVColumnEmittedAt, CSVColumnSettledAt, CSVColumnStatus, CSVColumnSide, CSVColumnOperationType,
+	CSVColumnAmount, CSVColumnCurrency, CSVColumnLocalAmount, CSVColumnLocalCurrency, CSVColumnLabel, CSVColumnNote,
+}
+
+// CSVOptions are the options of CSVWriter, zero value is a standard CSV
+type CSVOptions struct {
+	// Columns to write (DefaultCSVColumns if empty)
+	Columns []CSVColumn
+	// Delimiter is the field delimiter (',' if not set)
+	Delimiter rune
+	// DecimalSeparator of amounts ("." if not set)
+	DecimalSeparator string
+	// DateFormat is the time layout of dates (time.RFC3339 if not set)
+	DateFormat string
+	// Location of dates (UTC if not set)
+	Location *time.Location
+	// NoHeader disables the header line (column names)
+	NoHeader bool
+	// UseCRLF ends lines with \r\n
+	UseCRLF bool
+	// BOM writes a UTF-8 byte order mark first, so spreadsheets detect
+	// the encoding
+	BOM bool
+}
+
+// ExcelFrCSVOptions are options for French versions of Excel
+var ExcelFrCSVOptions = CSVOptions{
+	Delimiter:        ';',
+	DecimalSeparator: ",",
+	DateFormat:       "02/01/2006",
+	UseCRLF:          true,
+	BOM:              true,
+}
+
+// CSVWriter writes transactions as CSV
+type CSVWriter struct {
+	w       io.Writer
+	csv     *csv.Writer
+	options CSVOptions
+	started bool
+}
+
+// NewCSVWriter returns a CSVWriter writing to w
+func NewCSVWriter(w io.Writer, options CSVOptions) (*CSVWriter, error) {
+	if len(options.Columns) == 0 {
+		options.Columns = DefaultCSVColumns
+	}
+	for _, column := range options.Columns {
+		if !column.isKnown() {
+			return nil, fmt.Errorf("invalid CSV column %q", column)
+		}
+	}
+	if options.DecimalSeparator == "" {
+		options.DecimalSeparator = "."
+	}
+	if options.DateFormat == "" {
+		options.DateFormat = time.RFC3339
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	cw := &CSVWriter{w: w, csv: csv.NewWriter(w), options: options}
+	if options.Delimiter != 0 {
+		cw.csv.Comma = options.Delimiter
+	}
+	cw.csv.UseCRLF = options.UseCRLF
+	return cw, nil
+}
+
+// Write writes transactions, the header (and BOM) is written on first call
+// so Write can be called once per page of transactions.
+func (cw *CSVWriter) Write(transactions []Transaction) error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+	for _, t := range transactions {
+		record := make([]string, len(cw.options.Columns))
+		for i, column := range cw.options.Columns {
+			record[i] = cw.value(t, column)
+		}
+		if err := cw.csv.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes buffered data (and the header if nothing has been written)
+func (cw *CSVWriter) Flush() error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+	cw.csv.Flush()
+	return cw.csv.Error()
+}
+
+// start writes the BOM and the header if it's not done yet
+func (cw *CSVWriter) start() error {
+	if cw.started {
+		return nil
+	}
+	cw.started = true
+	if cw.options.BOM {
+		if _, err := io.WriteString(cw.w, "\uFEFF"); err != nil {
+			return err
+		}
+	}
+	if cw.options.NoHeader {
+		return nil
+	}
+	header := make([]string, len(cw.options.Columns))
+	for i, column := range cw.options.Columns {
+		header[i] = string(column)
+	}
+	return cw.csv.Write(header)
+}
+
+// value returns the value of column for t
+func (cw *CSVWriter) value(t Transaction, column CSVColumn) string {
+	switch column {
+	case CSVColumnID:
+		return t.ID
+	case CSVColumnEmittedAt:
+		return cw.date(t.EmittedAt)
+	case CSVColumnSettledAt:
+		return cw.date(t.SettleAt)
+	case CSVColumnStatus:
+		return string(t.Status)
+	case CSVColumnSide:
+		return string(t.Side)
+	case CSVColumnOperationType:
+		return string(t.OperationType)
+	case CSVColumnAmount:
+		return t.SignedMoney().Format(cw.options.DecimalSeparator)
+	case CSVColumnCurrency:
+		return t.Currency
+	case CSVColumnDebit:
+		if t.Side.IsDebit() {
+			return t.Money().Format(cw.options.DecimalSeparator)
+		}
+	case CSVColumnCredit:
+		if t.Side.IsCredit() {
+			return t.Money().Format(cw.options.DecimalSeparator)
+		}
+	case CSVColumnLocalAmount:
+		return t.SignedLocalMoney().Format(cw.options.DecimalSeparator)
+	case CSVColumnLocalCurrency:
+		return t.LocalCurrency
+	case CSVColumnLabel:
+		return t.Label
+	case CSVColumnNote:
+		return t.Note
+	}
+	return ""
+}
+
+// date formats t, empty if not set
+func (cw *CSVWriter) date(t Qtime) string {
+	if !t.Valid() {
+		return ""
+	}
+	return t.In(cw.options.Location).Format(cw.options.DateFormat)
+}
+
+// isKnown returns true if c is a CSV column
+func (c CSVColumn) isKnown() bool {
+	for _, column := range CSVColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCSVColumns parses a comma separated list of CSV columns
+func ParseCSVColumns(value string) (columns []CSVColumn, err error) {
+	for _, name := range strings.Split(value, ",") {
+		column := CSVColumn(strings.ToLower(strings.TrimSpace(name)))
+		if !column.isKnown() {
+			return nil, fmt.Errorf("invalid CSV column %q", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// WriteTransactionsCSV writes transactions as CSV to w
+func WriteTransactionsCSV(w io.Writer, transactions []Transaction, options CSVOptions) error {
+	cw, err := NewCSVWriter(w, options)
+	if err != nil {
+		return err
+	}
+	if err = cw.Write(transactions); err != nil {
+		return err
+	}
+	return cw.Flush()
+}
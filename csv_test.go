@@ -0,0 +1,78 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func csvTestTransactions() []Transaction {
+	emittedAt, _ := ParseQtime("2018-01-31T23:46:12.000Z")
+	return []Transaction{
+		{ID: "t1", AmountCents: 123450, LocalAmountCents: 150000, Currency: "EUR", LocalCurrency: "USD", Side: SideDebit, OperationType: OperationTypeCard, Status: StatusCompleted, EmittedAt: emittedAt, SettleAt: emittedAt, Label: "Hotel; New York"},
+		{ID: "t2", AmountCents: 5, LocalAmountCents: 5, Currency: "EUR", LocalCurrency: "EUR", Side: SideCredit, OperationType: OperationTypeIncome, Status: StatusPending, EmittedAt: emittedAt, Label: "Refund", Note: "see \"invoice\""},
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, WriteTransactionsCSV(&out, csvTestTransactions(), CSVOptions{}))
+	assert.Equal(t, `transaction_id,emitted_at,settled_at,status,side,operation_type,amount,currency,local_amount,local_currency,label,note
+t1,2018-01-31T23:46:12Z,2018-01-31T23:46:12Z,completed,debit,card,-1234.50,EUR,-1500.00,USD,Hotel; New York,
+t2,2018-01-31T23:46:12Z,,pending,credit,income,0.05,EUR,0.05,EUR,Refund,"see ""invoice"""
+`, out.String())
+
+	// French Excel, in Paris time
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	options := ExcelFrCSVOptions
+	options.Columns = []CSVColumn{CSVColumnSettledAt, CSVColumnLabel, CSVColumnDebit, CSVColumnCredit}
+	options.Location = paris
+	out.Reset()
+	cw, err := NewCSVWriter(&out, options)
+	assert.NoError(t, err)
+	// one call per page
+	for _, transaction := range csvTestTransactions() {
+		assert.NoError(t, cw.Write([]Transaction{transaction}))
+	}
+	assert.NoError(t, cw.Flush())
+	assert.Equal(t, "\uFEFFsettled_at;label;debit;credit\r\n01/02/2018;\"Hotel; New York\";1234,50;\r\n;Refund;;0,05\r\n", out.String())
+
+	// header only
+	out.Reset()
+	assert.NoError(t, WriteTransactionsCSV(&out, nil, CSVOptions{Columns: []CSVColumn{CSVColumnID}}))
+	assert.Equal(t, "transaction_id\n", out.String())
+
+	// columns
+	columns, err := ParseCSVColumns("settled_at, Label,amount")
+	assert.NoError(t, err)
+	assert.Equal(t, []CSVColumn{CSVColumnSettledAt, CSVColumnLabel, CSVColumnAmount}, columns)
+	_, err = ParseCSVColumns("settled_at,iban")
+	assert.Error(t, err)
+	_, err = NewCSVWriter(&out, CSVOptions{Columns: []CSVColumn{"balance"}})
+	assert.Error(t, err)
+}
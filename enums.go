@@ -0,0 +1,172 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import "encoding/json"
+
+// Side is the side of a transaction (credit or debit)
+// Values unknown to this package are kept as is, use IsKnown to check them.
+type Side string
+
+// Sides
+const (
+	SideCredit Side = "credit"
+	SideDebit  Side = "debit"
+)
+
+// OperationType is the type of a transaction operation
+// Values unknown to this package are kept as is, use IsKnown to check them.
+type OperationType string
+
+// Operation types
+const (
+	OperationTypeTransfer    OperationType = "transfer"
+	OperationTypeCard        OperationType = "card"
+	OperationTypeDirectDebit OperationType = "direct_debit"
+	OperationTypeIncome      OperationType = "income"
+	OperationTypeQontoFee    OperationType = "qonto_fee"
+	OperationTypeCheque      OperationType = "cheque"
+	OperationTypeRecall      OperationType = "recall"
+	OperationTypeSwiftIncome OperationType = "swift_income"
+)
+
+// Status is the status of a transaction
+// Values unknown to this package are kept as is, use IsKnown to check them.
+type Status string
+
+// Statuses
+const (
+	StatusPending   Status = "pending"
+	StatusReversed  Status = "reversed"
+	StatusDeclined  Status = "declined"
+	StatusCompleted Status = "completed"
+)
+
+// unknown is returned by stringers for empty values
+const unknown = "unknown"
+
+// unmarshalEnum decodes a JSON string (or null) into value
+func unmarshalEnum(b []byte, value *string) error {
+	if string(b) == "null" {
+		*value = ""
+		return nil
+	}
+	return json.Unmarshal(b, value)
+}
+
+// String is a stringer for Side, "unknown" if empty
+func (s Side) String() string {
+	if s == "" {
+		return unknown
+	}
+	return string(s)
+}
+
+// UnmarshalJSON is the Side unmarshaler, raw value is preserved
+func (s *Side) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum(b, (*string)(s))
+}
+
+// IsKnown returns true if s is a side known by this package
+func (s Side) IsKnown() bool {
+	return inEnum(string(s), transactionSides)
+}
+
+// IsCredit returns true for credit side
+func (s Side) IsCredit() bool {
+	return s == SideCredit
+}
+
+// IsDebit returns true for debit side
+func (s Side) IsDebit() bool {
+	return s == SideDebit
+}
+
+// String is a stringer for OperationType, "unknown" if empty
+func (o OperationType) String() string {
+	if o == "" {
+		return unknown
+	}
+	return string(o)
+}
+
+// UnmarshalJSON is the OperationType unmarshaler, raw value is preserved
+func (o *OperationType) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum(b, (*string)(o))
+}
+
+// IsKnown returns true if o is an operation type known by this package
+func (o OperationType) IsKnown() bool {
+	return inEnum(string(o), transactionOperationTypes)
+}
+
+// IsCard returns true for card operations
+func (o OperationType) IsCard() bool {
+	return o == OperationTypeCard
+}
+
+// IsTransfer returns true for transfer operations
+func (o OperationType) IsTransfer() bool {
+	return o == OperationTypeTransfer || o == OperationTypeSwiftIncome
+}
+
+// IsFee returns true for Qonto fees
+func (o OperationType) IsFee() bool {
+	return o == OperationTypeQontoFee
+}
+
+// String is a stringer for Status, "unknown" if empty
+func (s Status) String() string {
+	if s == "" {
+		return unknown
+	}
+	return string(s)
+}
+
+// UnmarshalJSON is the Status unmarshaler, raw value is preserved
+func (s *Status) UnmarshalJSON(b []byte) error {
+	return unmarshalEnum(b, (*string)(s))
+}
+
+// IsKnown returns true if s is a status known by this package
+func (s Status) IsKnown() bool {
+	return inEnum(string(s), transactionStatuses)
+}
+
+// IsPending returns true for pending transactions
+func (s Status) IsPending() bool {
+	return s == StatusPending
+}
+
+// IsSettled returns true for completed transactions
+func (s Status) IsSettled() bool {
+	return s == StatusCompleted
+}
+
+// IsDeclined returns true for declined transactions
+func (s Status) IsDeclined() bool {
+	return s == StatusDeclined
+}
+
+// IsReversed returns true for reversed transactions
+func (s Status) IsReversed() bool {
+	return s == StatusReversed
+}
@@ -0,0 +1,163 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// APIError is returned when Qonto API responds with a bad HTTP status
+// Use errors.As to get it from an error returned by the client.
+type APIError struct {
+	StatusCode int
+	Status     string
+	// Errors are the messages returned by Qonto in the response body
+	Errors []APIErrorMessage
+	// RequestID is the request id returned by Qonto (if any),
+	// you should provide it when contacting Qonto support
+	RequestID string
+	Header    http.Header
+	// Body is the raw response body
+	Body []byte
+}
+
+// APIErrorMessage is an error message returned by Qonto API
+type APIErrorMessage struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// String is a stringer for APIErrorMessage
+func (m APIErrorMessage) String() string {
+	if m.Code == "" {
+		return m.Detail
+	}
+	if m.Detail == "" {
+		return m.Code
+	}
+	return m.Code + ": " + m.Detail
+}
+
+// Error implements error interface
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("request failed - bad HTTP status returned: %s", e.Status)
+	if len(e.Errors) != 0 {
+		messages := make([]string, len(e.Errors))
+		for i, m := range e.Errors {
+			messages[i] = m.String()
+		}
+		msg += " - " + strings.Join(messages, ", ")
+	}
+	if e.RequestID != "" {
+		msg += " (request id: " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// newAPIError returns an APIError from a response and its body
+func newAPIError(response *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Header:     response.Header,
+		Body:       body,
+		RequestID:  response.Header.Get("X-Request-Id"),
+	}
+	if e.RequestID == "" {
+		e.RequestID = response.Header.Get("X-Qonto-Request-Id")
+	}
+	e.Errors = parseAPIErrorMessages(body)
+	return e
+}
+
+// parseAPIErrorMessages extracts error messages from a Qonto error body
+// Qonto returns either {"errors": [{"code": "...", "detail": "..."}]}
+// or {"message": "...", "errors": {"field": ["..."]}}
+func parseAPIErrorMessages(body []byte) (messages []APIErrorMessage) {
+	var raw struct {
+		Message string          `json:"message"`
+		Errors  json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil
+	}
+	if raw.Message != "" {
+		messages = append(messages, APIErrorMessage{Detail: raw.Message})
+	}
+	if len(raw.Errors) == 0 {
+		return
+	}
+	// list of objects
+	var list []APIErrorMessage
+	if err := json.Unmarshal(raw.Errors, &list); err == nil {
+		return append(messages, list...)
+	}
+	// list of strings
+	var strs []string
+	if err := json.Unmarshal(raw.Errors, &strs); err == nil {
+		for _, s := range strs {
+			messages = append(messages, APIErrorMessage{Detail: s})
+		}
+		return
+	}
+	// field -> messages
+	var fields map[string][]string
+	if err := json.Unmarshal(raw.Errors, &fields); err == nil {
+		names := make([]string, 0, len(fields))
+		for field := range fields {
+			names = append(names, field)
+		}
+		sort.Strings(names)
+		for _, field := range names {
+			for _, detail := range fields[field] {
+				messages = append(messages, APIErrorMessage{Code: field, Detail: detail})
+			}
+		}
+	}
+	return
+}
+
+// hasStatus returns true if err is an APIError with the given status code
+func hasStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+// IsNotFound returns true if err is an APIError with 404 status
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized returns true if err is an APIError with 401 status
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsUnprocessableEntity returns true if err is an APIError with 422 status
+// (invalid parameters)
+func IsUnprocessableEntity(err error) bool {
+	return hasStatus(err, http.StatusUnprocessableEntity)
+}
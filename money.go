@@ -0,0 +1,225 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of money in minor units (cents for EUR) of a currency
+// Use it instead of float64 amounts for accounting.
+type Money struct {
+	// Amount in minor units
+	Amount int64
+	// Currency ISO 4217 code
+	Currency string
+}
+
+// currencyExponents holds ISO 4217 currencies which don't use 2 decimals
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// CurrencyExponent returns the number of decimals of an ISO 4217 currency
+// (2 for unknown currencies)
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// NewMoney returns a Money of amount minor units of currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// ParseMoney parses a decimal amount ("1234.56", "-12,5") in currency
+func ParseMoney(value, currency string) (Money, error) {
+	m := Money{Currency: strings.ToUpper(currency)}
+	exponent := CurrencyExponent(currency)
+	s := strings.TrimSpace(value)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	if s == "" {
+		return m, fmt.Errorf("invalid amount %q: empty amount", value)
+	}
+	s = strings.Replace(s, ",", ".", 1)
+	parts := strings.SplitN(s, ".", 2)
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+	if parts[0] == "" && fraction == "" {
+		return m, fmt.Errorf("invalid amount %q: no digits", value)
+	}
+	if parts[0] == "" {
+		parts[0] = "0"
+	}
+	if len(fraction) > exponent {
+		return m, fmt.Errorf("invalid amount %q: too many decimals for %s", value, m.Currency)
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+	amount, err := strconv.ParseInt(parts[0]+fraction, 10, 64)
+	if err != nil || strings.ContainsAny(parts[0]+fraction, "+-") {
+		return m, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+	m.Amount = amount
+	return m, nil
+}
+
+// Format returns the amount as a decimal number using decimalSeparator,
+// without currency (e.g. "-1234,56")
+func (m Money) Format(decimalSeparator string) string {
+	exponent := CurrencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatUint(abs64(amount), 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + decimalSeparator + digits[len(digits)-exponent:]
+}
+
+// Decimal returns the amount as a decimal number (e.g. "-1234.56")
+func (m Money) Decimal() string {
+	return m.Format(".")
+}
+
+// String is a stringer for Money (e.g. "1234.56 EUR")
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Add returns m + o, currencies must match
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.checkCurrency(o); err != nil {
+		return m, err
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - o, currencies must match
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.checkCurrency(o); err != nil {
+		return m, err
+	}
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}, nil
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Abs returns the absolute value of m
+func (m Money) Abs() Money {
+	return Money{Amount: int64(abs64(m.Amount)), Currency: m.Currency}
+}
+
+// Cmp compares m and o and returns -1 if m < o, 0 if m == o, +1 if m > o
+// Currencies must match.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.checkCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Equal returns true if m and o have same amount and currency
+func (m Money) Equal(o Money) bool {
+	return m.Amount == o.Amount && strings.EqualFold(m.Currency, o.Currency)
+}
+
+// IsZero returns true if amount is 0
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative returns true if amount is lower than 0
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// IsPositive returns true if amount is greater than 0
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) checkCurrency(o Money) error {
+	if !strings.EqualFold(m.Currency, o.Currency) {
+		return fmt.Errorf("currency mismatch: %s and %s", m.Currency, o.Currency)
+	}
+	return nil
+}
+
+// jsonMoney is the JSON representation of Money
+type jsonMoney struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON is the Money marshaler: {"value": "1234.56", "currency": "EUR"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Value: m.Decimal(), Currency: m.Currency})
+}
+
+// UnmarshalJSON is the Money unmarshaler
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var j jsonMoney
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	money, err := ParseMoney(j.Value, j.Currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+func abs64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-n)
+	}
+	return uint64(n)
+}
@@ -0,0 +1,106 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoneyFormat(t *testing.T) {
+	assert.Equal(t, "1234.56 EUR", NewMoney(123456, "eur").String())
+	assert.Equal(t, "-0.05", NewMoney(-5, "EUR").Decimal())
+	assert.Equal(t, "0,00", NewMoney(0, "EUR").Format(","))
+	assert.Equal(t, "1234 JPY", NewMoney(1234, "JPY").String())
+	assert.Equal(t, "1.234 KWD", NewMoney(1234, "KWD").String())
+}
+
+func TestParseMoney(t *testing.T) {
+	m, err := ParseMoney("1234.5", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, NewMoney(123450, "EUR"), m)
+	m, err = ParseMoney("-12,34", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1234), m.Amount)
+	m, err = ParseMoney("42", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), m.Amount)
+	_, err = ParseMoney("1.234", "EUR")
+	assert.Error(t, err)
+	_, err = ParseMoney("abc", "EUR")
+	assert.Error(t, err)
+	_, err = ParseMoney("--1", "EUR")
+	assert.Error(t, err)
+	_, err = ParseMoney("", "EUR")
+	assert.Error(t, err)
+	_, err = ParseMoney(" - ", "EUR")
+	assert.Error(t, err)
+	for _, value := range []string{".", ",", " . ", "-.", "+,"} {
+		_, err = ParseMoney(value, "EUR")
+		assert.Error(t, err, value)
+	}
+	m, err = ParseMoney(".5", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), m.Amount)
+	m, err = ParseMoney("12.", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1200), m.Amount)
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a := NewMoney(1000, "EUR")
+	b := NewMoney(250, "EUR")
+	sum, err := a.Add(b)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1250), sum.Amount)
+	diff, err := b.Sub(a)
+	assert.NoError(t, err)
+	assert.True(t, diff.IsNegative())
+	assert.Equal(t, int64(750), diff.Abs().Amount)
+	cmp, err := a.Cmp(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cmp)
+	_, err = a.Add(NewMoney(1, "USD"))
+	assert.EqualError(t, err, "currency mismatch: EUR and USD")
+	assert.True(t, a.Equal(NewMoney(1000, "eur")))
+}
+
+func TestMoneyJSON(t *testing.T) {
+	m := NewMoney(-123456, "EUR")
+	b, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"value":"-1234.56","currency":"EUR"}`, string(b))
+	var decoded Money
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, m, decoded)
+}
+
+func TestModelsMoney(t *testing.T) {
+	tx := Transaction{AmountCents: 1050, Currency: "EUR", LocalAmountCents: 1200, LocalCurrency: "USD", Side: SideDebit}
+	assert.Equal(t, NewMoney(1050, "EUR"), tx.Money())
+	assert.Equal(t, NewMoney(-1050, "EUR"), tx.SignedMoney())
+	assert.Equal(t, NewMoney(1200, "USD"), tx.LocalMoney())
+	account := BankAccount{Currency: "EUR", BalanceCents: 100, AuthorizedBalanceCents: 50}
+	assert.Equal(t, "1.00 EUR", account.BalanceMoney().String())
+	assert.Equal(t, "0.50 EUR", account.AuthorizedBalanceMoney().String())
+}
@@ -0,0 +1,220 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	mt940DateFormat = "060102"
+	// mt940Charset is the SWIFT x character set
+	mt940Charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789/-?:().,'+ "
+	// lengths of :20: and :61: references, :61: supplementary details and
+	// :86: lines
+	mt940ReferenceLength = 16
+	mt940DetailsLength   = 34
+	mt940InfoLength      = 65
+	mt940InfoLines       = 6
+)
+
+// mt940Transliterations maps characters outside of the SWIFT character set
+// to allowed ones, other characters are replaced by spaces
+var mt940Transliterations = func() map[rune]string {
+	m := map[rune]string{
+		'&': "+", '_': "-", '"': "'", '’': "'", ';': ",", '!': ".",
+		'<': "(", '[': "(", '{': "(", '>': ")", ']': ")", '}': ")",
+		'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'ß': "ss", '€': "EUR",
+	}
+	for ascii, runes := range map[string]string{
+		"A": "ÀÁÂÃÄÅ", "a": "àáâãäå", "C": "Ç", "c": "ç", "E": "ÈÉÊË", "e": "èéêë",
+		"I": "ÌÍÎÏ", "i": "ìíîï", "N": "Ñ", "n": "ñ", "O": "ÒÓÔÕÖØ", "o": "òóôõöø",
+		"U": "ÙÚÛÜ", "u": "ùúûü", "Y": "Ý", "y": "ýÿ",
+	} {
+		for _, r := range runes {
+			m[r] = ascii
+		}
+	}
+	return m
+}()
+
+// mt940TransactionTypes maps operation types to SWIFT transaction type
+// identification codes of :61: (MSC if not mapped)
+var mt940TransactionTypes = map[OperationType]string{
+	OperationTypeTransfer:    "TRF",
+	OperationTypeDirectDebit: "DDT",
+	OperationTypeIncome:      "TRF",
+	OperationTypeQontoFee:    "CHG",
+	OperationTypeCheque:      "CHK",
+	OperationTypeRecall:      "RTI",
+	OperationTypeSwiftIncome: "TRF",
+}
+
+// MT940Options are the options of WriteMT940
+type MT940Options struct {
+	// Reference of the statement (:20:, 16 characters, "QONTO" followed
+	// by the closing date if not set)
+	Reference string
+	// StatementNumber (:28C:, 1 if not set)
+	StatementNumber int
+}
+
+// WriteMT940 writes statement as a SWIFT MT940 customer statement message
+// (text block only): reference (:20:), IBAN (:25:), statement number
+// (:28C:), opening balance (:60F:), one :61: line and its :86: information
+// per completed transaction, closing balance (:62F:), then the "-" end of
+// message. MT940 statements only hold booked entries, pending, declined and
+// reversed transactions are not written.
+// Texts are transliterated to the SWIFT character set and wrapped to the
+// field lengths, lines end with CRLF. Dates are in the location of
+// statement.From.
+func WriteMT940(w io.Writer, statement Statement, options MT940Options) error {
+	opening, err := statement.Opening()
+	if err != nil {
+		return err
+	}
+	loc := statement.From.Location()
+	date := func(t time.Time) string {
+		return t.In(loc).Format(mt940DateFormat)
+	}
+	reference := truncate(mt940Reference(options.Reference), mt940ReferenceLength)
+	if reference == "" {
+		reference = "QONTO" + date(statement.To)
+	}
+	number := options.StatementNumber
+	if number <= 0 {
+		number = 1
+	}
+
+	bw := bufio.NewWriter(w)
+	field := func(tag string, lines ...string) {
+		bw.WriteString(":" + tag + ":" + strings.Join(lines, "\r\n") + "\r\n")
+	}
+	field("20", reference)
+	field("25", compactIBAN(statement.Account.Iban))
+	field("28C", fmt.Sprintf("%05d/001", number))
+	field("60F", mt940Balance(opening, date(statement.From)))
+	for _, t := range statement.Booked() {
+		booked := bookingDate(t).In(loc)
+		amount := t.SignedMoney()
+		typ, ok := mt940TransactionTypes[t.OperationType]
+		if !ok {
+			typ = "MSC"
+		}
+		// value date, entry date, mark, amount, type, customer reference
+		// and bank reference
+		lines := []string{booked.Format(mt940DateFormat) + booked.Format("0102") + mt940Mark(amount) +
+			amount.Abs().Format(",") + "N" + typ + "NONREF//" + mt940TransactionReference(t.ID)}
+		lines = append(lines, mt940Wrap(mt940Text(t.Label), mt940DetailsLength, 1)...)
+		field("61", lines...)
+		if info := mt940Wrap(mt940Text(t.Label+" "+t.Note), mt940InfoLength, mt940InfoLines); len(info) > 0 {
+			field("86", info...)
+		}
+	}
+	field("62F", mt940Balance(statement.Closing(), date(statement.To)))
+	bw.WriteString("-\r\n")
+	return bw.Flush()
+}
+
+// mt940Balance returns a :60F: or :62F: balance
+func mt940Balance(balance Money, date string) string {
+	return mt940Mark(balance) + date + balance.Currency + balance.Abs().Format(",")
+}
+
+// mt940Mark returns the debit/credit mark of m
+func mt940Mark(m Money) string {
+	if m.IsNegative() {
+		return "D"
+	}
+	return "C"
+}
+
+// mt940Text returns s transliterated to the SWIFT character set, on one
+// line
+func mt940Text(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(mt940Charset, r) {
+			b.WriteRune(r)
+		} else if ascii, ok := mt940Transliterations[r]; ok {
+			b.WriteString(ascii)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// mt940Reference returns s as a reference: references can't contain
+// slashes nor spaces
+func mt940Reference(s string) string {
+	return strings.NewReplacer("/", "-", " ", "").Replace(mt940Text(s))
+}
+
+// mt940TransactionReference returns the last 16 characters of the
+// reference of id, the end of Qonto transaction IDs is the unique part
+func mt940TransactionReference(id string) string {
+	reference := mt940Reference(id)
+	if len(reference) > mt940ReferenceLength {
+		return reference[len(reference)-mt940ReferenceLength:]
+	}
+	return reference
+}
+
+// mt940Wrap wraps text (in the SWIFT character set) on at most max lines
+// of width characters. Lines starting with ":" or "-" would be read as a
+// new field or as the end of the message, these characters are replaced
+// by ".".
+func mt940Wrap(text string, width, max int) (lines []string) {
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for word != "" {
+			if line != "" && len(line)+1+len(word) <= width {
+				line += " " + word
+				break
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			n := len(word)
+			if n > width {
+				n = width
+			}
+			line, word = word[:n], word[n:]
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	if len(lines) > max {
+		lines = lines[:max]
+	}
+	for i, l := range lines {
+		if l[0] == ':' || l[0] == '-' {
+			lines[i] = "." + l[1:]
+		}
+	}
+	return
+}
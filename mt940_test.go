@@ -0,0 +1,77 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMT940(t *testing.T) {
+	statement := testStatement()
+	statement.Transactions[0].ID = "my-orga-42-bank-account-1-transaction-123456789012"
+	statement.Transactions[1].Note = "Société Générale: règlement"
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteMT940(&out, statement, MT940Options{}))
+	assert.Equal(t, strings.Join([]string{
+		":20:QONTO180131",
+		":25:FR7616958000011234567890123",
+		":28C:00001/001",
+		":60F:D180101EUR2765,50",
+		":61:1801180118D1234,50NMSCNONREF//ion-123456789012",
+		"Hotel + Spa (New York) - Fifth",
+		":86:Hotel + Spa (New York) - Fifth Avenue trip",
+		":61:1801180118C5000,00NTRFNONREF//t2",
+		"Invoice 42",
+		":86:Invoice 42 Societe Generale: reglement",
+		":62F:C180131EUR1000,00",
+		"-",
+		"",
+	}, "\r\n"), out.String())
+
+	out.Reset()
+	statement.Transactions = nil
+	assert.NoError(t, WriteMT940(&out, statement, MT940Options{Reference: "Relevé n°2/2018 janvier", StatementNumber: 2}))
+	assert.True(t, strings.HasPrefix(out.String(), ":20:Releven2-2018jan\r\n:25:FR7616958000011234567890123\r\n:28C:00002/001\r\n:60F:C180101EUR1000,00\r\n:62F:"))
+
+	statement.ClosingBalance = NewMoney(2000, "USD")
+	statement.Transactions = testStatement().Transactions
+	assert.Error(t, WriteMT940(&out, statement, MT940Options{}))
+}
+
+func TestMT940Text(t *testing.T) {
+	assert.Equal(t, "Cafe + Creme (Paris) 'Noel' 5EUR", mt940Text("Café & Crème <Paris>\n\"Noël\"  5€"))
+	assert.Equal(t, "Foo bar", mt940Text("Foo @#* bar"))
+
+	text := mt940Text(strings.Repeat("abcdefghij ", 40))
+	lines := mt940Wrap(text, 65, 6)
+	assert.Len(t, lines, 6)
+	for _, line := range lines {
+		assert.True(t, len(line) <= 65)
+	}
+	assert.Equal(t, []string{"abcde", "fghij", "k"}, mt940Wrap("abcdefghijk", 5, 6))
+	assert.Equal(t, []string{"ab", ".c", ".d"}, mt940Wrap("ab :c -d", 2, 6))
+	assert.Nil(t, mt940Wrap("", 65, 6))
+}
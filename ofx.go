@@ -0,0 +1,234 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// OFXVersion is the version of generated OFX files
+type OFXVersion int
+
+// OFX versions
+const (
+	// OFX102 is OFX 1.0.2 (SGML)
+	OFX102 OFXVersion = 102
+	// OFX220 is OFX 2.2 (XML)
+	OFX220 OFXVersion = 220
+)
+
+const (
+	// OFX date format, the time zone is added
+	ofxDateFormat = "20060102150405.000"
+	// max length of NAME
+	ofxNameLength = 32
+	// max length of MEMO
+	ofxMemoLength = 255
+)
+
+// ofxNode is an OFX element, an aggregate (with children) or a leaf (with
+// a value)
+type ofxNode struct {
+	name     string
+	value    string
+	children []*ofxNode
+}
+
+// add adds children to n and returns n
+func (n *ofxNode) add(children ...*ofxNode) *ofxNode {
+	n.children = append(n.children, children...)
+	return n
+}
+
+// ofxAggregate returns an aggregate
+func ofxAggregate(name string, children ...*ofxNode) *ofxNode {
+	return &ofxNode{name: name, children: children}
+}
+
+// ofxLeaf returns a leaf element
+func ofxLeaf(name, value string) *ofxNode {
+	return &ofxNode{name: name, value: value}
+}
+
+// ofxDate formats t as an OFX date (in UTC)
+func ofxDate(t time.Time) string {
+	return t.UTC().Format(ofxDateFormat) + "[0:GMT]"
+}
+
+// ofxEscape escapes special characters of OFX values
+var ofxEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// truncate returns the first n runes of s
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// WriteOFX writes statement as an OFX bank statement response
+// Transactions are mapped to STMTTRN: Side to TRNTYPE (CREDIT or DEBIT), ID
+// to FITID, SettleAt to DTPOSTED (EmittedAt if not settled), EmittedAt to
+// DTUSER and Label to NAME. The closing balance is the LEDGERBAL.
+// Declined and reversed transactions have not moved money, they are not
+// written.
+// For French IBANs, BANKID, BRANCHID and ACCTID are the bank code, branch
+// code and account number (with its key) of the IBAN, as French banks do.
+// Otherwise BANKID is the BIC (8 characters) and ACCTID the IBAN.
+func WriteOFX(w io.Writer, statement Statement, version OFXVersion) error {
+	if version != OFX102 && version != OFX220 {
+		return fmt.Errorf("unsupported OFX version %d", version)
+	}
+	ofx, err := ofxStatement(statement)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if version == OFX102 {
+		fmt.Fprint(bw, "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:UNICODE\r\nCHARSET:NONE\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n")
+	} else {
+		fmt.Fprint(bw, "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n<?OFX OFXHEADER=\"200\" VERSION=\"220\" SECURITY=\"NONE\" OLDFILEUID=\"NONE\" NEWFILEUID=\"NONE\"?>\n")
+	}
+	writeOFXNode(bw, ofx, 0, version == OFX102)
+	return bw.Flush()
+}
+
+// writeOFXNode writes n, leaves have no end tag in SGML
+func writeOFXNode(w *bufio.Writer, n *ofxNode, depth int, sgml bool) {
+	indent := strings.Repeat("  ", depth)
+	newline := "\n"
+	if sgml {
+		newline = "\r\n"
+	}
+	if n.children == nil {
+		fmt.Fprintf(w, "%s<%s>%s", indent, n.name, ofxEscape.Replace(n.value))
+		if !sgml {
+			fmt.Fprintf(w, "</%s>", n.name)
+		}
+		w.WriteString(newline)
+		return
+	}
+	fmt.Fprintf(w, "%s<%s>%s", indent, n.name, newline)
+	for _, child := range n.children {
+		writeOFXNode(w, child, depth+1, sgml)
+	}
+	fmt.Fprintf(w, "%s</%s>%s", indent, n.name, newline)
+}
+
+// ofxStatement returns the OFX element of statement
+func ofxStatement(statement Statement) (*ofxNode, error) {
+	createdAt := statement.createdAt()
+	currency := statement.Currency()
+	status := func() *ofxNode {
+		return ofxAggregate("STATUS", ofxLeaf("CODE", "0"), ofxLeaf("SEVERITY", "INFO"))
+	}
+
+	account := ofxAggregate("BANKACCTFROM")
+	if bank, branch, number, ok := frenchBBAN(statement.Account.Iban); ok {
+		account.add(ofxLeaf("BANKID", bank), ofxLeaf("BRANCHID", branch), ofxLeaf("ACCTID", number))
+	} else {
+		account.add(ofxLeaf("BANKID", truncate(statement.Account.Bic, 8)), ofxLeaf("ACCTID", compactIBAN(statement.Account.Iban)))
+	}
+	account.add(ofxLeaf("ACCTTYPE", "CHECKING"))
+
+	transactions := ofxAggregate("BANKTRANLIST", ofxLeaf("DTSTART", ofxDate(statement.From)), ofxLeaf("DTEND", ofxDate(statement.To)))
+	for _, t := range statement.Transactions {
+		if t.Status.IsDeclined() || t.Status.IsReversed() {
+			continue
+		}
+		amount := t.SignedMoney()
+		if !strings.EqualFold(amount.Currency, currency) {
+			return nil, fmt.Errorf("transaction %s: currency %s doesn't match statement currency %s", t.ID, amount.Currency, currency)
+		}
+		trnType := "CREDIT"
+		if t.Side.IsDebit() {
+			trnType = "DEBIT"
+		}
+		trn := ofxAggregate("STMTTRN",
+			ofxLeaf("TRNTYPE", trnType),
+			ofxLeaf("DTPOSTED", ofxDate(bookingDate(t))),
+		)
+		if t.EmittedAt.Valid() {
+			trn.add(ofxLeaf("DTUSER", ofxDate(t.EmittedAt.Time)))
+		}
+		trn.add(
+			ofxLeaf("TRNAMT", amount.Decimal()),
+			ofxLeaf("FITID", t.ID),
+			ofxLeaf("NAME", truncate(t.Label, ofxNameLength)),
+		)
+		var memo []string
+		if utf8.RuneCountInString(t.Label) > ofxNameLength {
+			memo = append(memo, t.Label)
+		}
+		if t.Note != "" {
+			memo = append(memo, t.Note)
+		}
+		if len(memo) != 0 {
+			trn.add(ofxLeaf("MEMO", truncate(strings.Join(memo, " - "), ofxMemoLength)))
+		}
+		transactions.add(trn)
+	}
+
+	return ofxAggregate("OFX",
+		ofxAggregate("SIGNONMSGSRSV1",
+			ofxAggregate("SONRS",
+				status(),
+				ofxLeaf("DTSERVER", ofxDate(createdAt)),
+				ofxLeaf("LANGUAGE", "ENG"),
+			),
+		),
+		ofxAggregate("BANKMSGSRSV1",
+			ofxAggregate("STMTTRNRS",
+				ofxLeaf("TRNUID", "0"),
+				status(),
+				ofxAggregate("STMTRS",
+					ofxLeaf("CURDEF", currency),
+					account,
+					transactions,
+					ofxAggregate("LEDGERBAL",
+						ofxLeaf("BALAMT", statement.Closing().Decimal()),
+						ofxLeaf("DTASOF", ofxDate(statement.To)),
+					),
+				),
+			),
+		),
+	), nil
+}
+
+// compactIBAN returns iban without spaces, in upper case
+func compactIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// frenchBBAN returns the bank code, branch code and account number (with
+// its key) of a French (or Monaco) IBAN
+func frenchBBAN(iban string) (bank, branch, account string, ok bool) {
+	iban = compactIBAN(iban)
+	if len(iban) != 27 || (!strings.HasPrefix(iban, "FR") && !strings.HasPrefix(iban, "MC")) {
+		return "", "", "", false
+	}
+	return iban[4:9], iban[9:14], iban[14:27], true
+}
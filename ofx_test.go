@@ -0,0 +1,156 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStatement() Statement {
+	settledAt, _ := ParseQtime("2018-01-18T06:46:12.000Z")
+	emittedAt, _ := ParseQtime("2018-01-17T10:00:00.000Z")
+	return Statement{
+		Account: BankAccount{
+			Slug:         "my-orga-42-bank-account-1",
+			Iban:         "FR76 1695 8000 0112 3456 7890 123",
+			Bic:          "QNTOFRP1XXX",
+			Currency:     "EUR",
+			BalanceCents: 100000,
+		},
+		From: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2018, 1, 31, 23, 59, 59, 0, time.UTC),
+		Transactions: []Transaction{
+			{ID: "t1", AmountCents: 123450, Currency: "EUR", Side: SideDebit, OperationType: OperationTypeCard, Status: StatusCompleted, EmittedAt: emittedAt, SettleAt: settledAt, Label: "Hotel & Spa <New York> - Fifth Avenue", Note: "trip"},
+			{ID: "t2", AmountCents: 500000, Currency: "EUR", Side: SideCredit, OperationType: OperationTypeIncome, Status: StatusCompleted, EmittedAt: emittedAt, SettleAt: settledAt, Label: "Invoice 42"},
+			{ID: "t3", AmountCents: 1000, Currency: "EUR", Side: SideDebit, OperationType: OperationTypeCard, Status: StatusPending, EmittedAt: emittedAt, Label: "Coffee"},
+		},
+		CreatedAt: time.Date(2018, 2, 1, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestStatement(t *testing.T) {
+	statement := testStatement()
+	assert.Equal(t, "EUR", statement.Currency())
+	assert.Equal(t, NewMoney(100000, "EUR"), statement.Closing())
+	assert.Len(t, statement.Booked(), 2)
+	opening, err := statement.Opening()
+	assert.NoError(t, err)
+	// 1000.00 + 1234.50 - 5000.00
+	assert.Equal(t, NewMoney(-276550, "EUR"), opening)
+
+	statement.ClosingBalance = NewMoney(2000, "USD")
+	_, err = statement.Opening()
+	assert.Error(t, err)
+}
+
+// ofxDocument is the part of an OFX 2 document checked by tests
+type ofxDocument struct {
+	XMLName  xml.Name `xml:"OFX"`
+	DTServer string   `xml:"SIGNONMSGSRSV1>SONRS>DTSERVER"`
+	Stmt     struct {
+		Currency string `xml:"CURDEF"`
+		BankID   string `xml:"BANKACCTFROM>BANKID"`
+		BranchID string `xml:"BANKACCTFROM>BRANCHID"`
+		AcctID   string `xml:"BANKACCTFROM>ACCTID"`
+		DTStart  string `xml:"BANKTRANLIST>DTSTART"`
+		DTEnd    string `xml:"BANKTRANLIST>DTEND"`
+		Trns     []struct {
+			Type     string `xml:"TRNTYPE"`
+			DTPosted string `xml:"DTPOSTED"`
+			DTUser   string `xml:"DTUSER"`
+			Amount   string `xml:"TRNAMT"`
+			FITID    string `xml:"FITID"`
+			Name     string `xml:"NAME"`
+			Memo     string `xml:"MEMO"`
+		} `xml:"BANKTRANLIST>STMTTRN"`
+		Balance string `xml:"LEDGERBAL>BALAMT"`
+		AsOf    string `xml:"LEDGERBAL>DTASOF"`
+	} `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS"`
+}
+
+func TestOFX(t *testing.T) {
+	var out bytes.Buffer
+	statement := testStatement()
+	statement.Transactions = append(statement.Transactions,
+		Transaction{ID: "t4", AmountCents: 999, Currency: "EUR", Side: SideDebit, Status: StatusDeclined, Label: "Declined"},
+		Transaction{ID: "t5", AmountCents: 999, Currency: "EUR", Side: SideDebit, Status: StatusReversed, Label: "Reversed"},
+	)
+	assert.NoError(t, WriteOFX(&out, statement, OFX220))
+	assert.True(t, strings.HasPrefix(out.String(), "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n<?OFX OFXHEADER=\"200\" VERSION=\"220\""))
+
+	var doc ofxDocument
+	assert.NoError(t, xml.Unmarshal(out.Bytes(), &doc))
+	assert.Equal(t, "20180201080000.000[0:GMT]", doc.DTServer)
+	assert.Equal(t, "EUR", doc.Stmt.Currency)
+	assert.Equal(t, "16958", doc.Stmt.BankID)
+	assert.Equal(t, "00001", doc.Stmt.BranchID)
+	assert.Equal(t, "1234567890123", doc.Stmt.AcctID)
+	assert.Equal(t, "20180101000000.000[0:GMT]", doc.Stmt.DTStart)
+	assert.Equal(t, "20180131235959.000[0:GMT]", doc.Stmt.DTEnd)
+	assert.Equal(t, "1000.00", doc.Stmt.Balance)
+	assert.Equal(t, "20180131235959.000[0:GMT]", doc.Stmt.AsOf)
+	if assert.Len(t, doc.Stmt.Trns, 3) {
+		trn := doc.Stmt.Trns[0]
+		assert.Equal(t, "DEBIT", trn.Type)
+		assert.Equal(t, "20180118064612.000[0:GMT]", trn.DTPosted)
+		assert.Equal(t, "20180117100000.000[0:GMT]", trn.DTUser)
+		assert.Equal(t, "-1234.50", trn.Amount)
+		assert.Equal(t, "t1", trn.FITID)
+		assert.Equal(t, "Hotel & Spa <New York> - Fifth A", trn.Name)
+		assert.Equal(t, "Hotel & Spa <New York> - Fifth Avenue - trip", trn.Memo)
+		assert.Equal(t, "CREDIT", doc.Stmt.Trns[1].Type)
+		assert.Equal(t, "5000.00", doc.Stmt.Trns[1].Amount)
+		assert.Empty(t, doc.Stmt.Trns[1].Memo)
+		// not settled
+		assert.Equal(t, "20180117100000.000[0:GMT]", doc.Stmt.Trns[2].DTPosted)
+	}
+
+	// SGML
+	out.Reset()
+	assert.NoError(t, WriteOFX(&out, testStatement(), OFX102))
+	assert.True(t, strings.HasPrefix(out.String(), "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:UNICODE\r\nCHARSET:NONE\r\n"))
+	assert.Contains(t, out.String(), "\r\n\r\n<OFX>\r\n")
+	assert.Contains(t, out.String(), "<TRNTYPE>DEBIT\r\n")
+	assert.Contains(t, out.String(), "<NAME>Hotel &amp; Spa &lt;New York&gt; - Fifth A\r\n")
+	assert.Contains(t, out.String(), "</STMTTRN>\r\n")
+	assert.NotContains(t, out.String(), "</TRNTYPE>")
+
+	// not French IBAN
+	statement = testStatement()
+	statement.Account.Iban = "DE89 3704 0044 0532 0130 00"
+	out.Reset()
+	assert.NoError(t, WriteOFX(&out, statement, OFX220))
+	doc = ofxDocument{}
+	assert.NoError(t, xml.Unmarshal(out.Bytes(), &doc))
+	assert.Equal(t, "QNTOFRP1", doc.Stmt.BankID)
+	assert.Equal(t, "DE89370400440532013000", doc.Stmt.AcctID)
+
+	// errors
+	assert.Error(t, WriteOFX(&out, testStatement(), 151))
+	statement.Transactions[0].Currency = "USD"
+	assert.Error(t, WriteOFX(&out, statement, OFX220))
+}
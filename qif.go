@@ -0,0 +1,91 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// QIFOptions are the options of WriteQIF, zero value is a US QIF
+type QIFOptions struct {
+	// DateFormat is the time layout of dates ("01/02/2006" if not set, use
+	// "02/01/2006" for European tools)
+	DateFormat string
+	// DecimalSeparator of amounts ("." if not set)
+	DecimalSeparator string
+	// Location of dates (UTC if not set)
+	Location *time.Location
+	// UseCRLF ends lines with \r\n
+	UseCRLF bool
+}
+
+// WriteQIF writes transactions as a QIF bank account (!Type:Bank)
+// For each transaction: D is the settlement date (emission date if not
+// settled), T the amount (negative for debits), P the label, M the note
+// and C the cleared flag ("*" for completed transactions, none for pending
+// ones). Declined and reversed transactions have not moved money, they are
+// not written.
+func WriteQIF(w io.Writer, transactions []Transaction, options QIFOptions) error {
+	if options.DateFormat == "" {
+		options.DateFormat = "01/02/2006"
+	}
+	if options.DecimalSeparator == "" {
+		options.DecimalSeparator = "."
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	newline := "\n"
+	if options.UseCRLF {
+		newline = "\r\n"
+	}
+	bw := bufio.NewWriter(w)
+	line := func(code, value string) {
+		bw.WriteString(code + value + newline)
+	}
+	line("!Type:Bank", "")
+	for _, t := range transactions {
+		if t.Status.IsDeclined() || t.Status.IsReversed() {
+			continue
+		}
+		line("D", bookingDate(t).In(options.Location).Format(options.DateFormat))
+		line("T", t.SignedMoney().Format(options.DecimalSeparator))
+		if t.Status.IsSettled() {
+			line("C", "*")
+		}
+		if label := qifValue(t.Label); label != "" {
+			line("P", label)
+		}
+		if note := qifValue(t.Note); note != "" {
+			line("M", note)
+		}
+		line("^", "")
+	}
+	return bw.Flush()
+}
+
+// qifValue returns value on one line
+func qifValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,59 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQIF(t *testing.T) {
+	transactions := testStatement().Transactions
+	transactions[1].Note = "January\ninvoice"
+	transactions = append(transactions, Transaction{ID: "t4", AmountCents: 999, Currency: "EUR", Side: SideDebit, Status: StatusDeclined, Label: "Declined"})
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteQIF(&out, transactions, QIFOptions{}))
+	assert.Equal(t, `!Type:Bank
+D01/18/2018
+T-1234.50
+C*
+PHotel & Spa <New York> - Fifth Avenue
+Mtrip
+^
+D01/18/2018
+T5000.00
+C*
+PInvoice 42
+MJanuary invoice
+^
+D01/17/2018
+T-10.00
+PCoffee
+^
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, WriteQIF(&out, transactions[2:3], QIFOptions{DateFormat: "02/01/2006", DecimalSeparator: ",", UseCRLF: true}))
+	assert.Equal(t, "!Type:Bank\r\nD17/01/2018\r\nT-10,00\r\nPCoffee\r\n^\r\n", out.String())
+}
@@ -0,0 +1,344 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// nagios output format (monitoring plugin)
+const outputNagios = "nagios"
+
+// checkStatus is a monitoring plugin status, its value is the exit code
+type checkStatus int
+
+// monitoring plugin statuses
+const (
+	checkOK checkStatus = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+// String is a stringer for checkStatus
+func (s checkStatus) String() string {
+	switch s {
+	case checkOK:
+		return "OK"
+	case checkWarning:
+		return "WARNING"
+	case checkCritical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// balanceCmd represents the balance command
+var balanceCmd = &cobra.Command{
+	Use:   "balance",
+	Short: "Display balances of your bank accounts, with optional thresholds for monitoring",
+	Long: `
+Display balance and authorized balance of your bank accounts.
+
+With --warn and/or --crit, the authorized balance (or the balance, see
+--threshold-on) of each account is checked and qonto exits with a monitoring
+plugin exit code: 0 (OK), 1 (WARNING, below --warn), 2 (CRITICAL, below
+--crit) or 3 (UNKNOWN, unable to get balances). Thresholds are amounts in the
+currency of the account.
+
+With --output nagios, a monitoring plugin status line with perfdata is
+displayed. With --sum, balances of accounts are summed per currency (and
+thresholds apply to sums).
+
+Examples:
+
+1 - Balances of all your accounts
+qonto balance
+
+2 - Nagios (or Icinga, Centreon,...) check
+qonto balance -o nagios --warn 10000 --crit 5000
+QONTO BALANCE WARNING - my-orga-42-bank-account-1: 8000.00 EUR | 'my-orga-42-bank-account-1'=8000.00;10000.00:;5000.00:;;
+
+3 - Cron check of the total cash in EUR
+qonto balance --sum --crit 5000 > /dev/null || echo "low cash" | mail -s "qonto" boss@example.com
+`,
+	Run: balance,
+}
+
+func init() {
+	rootCmd.AddCommand(balanceCmd)
+
+	// flags are not bound to viper, keys would collide with the ones of
+	// the watch command
+	flags := balanceCmd.Flags()
+	flags.StringSliceP("slug", "s", nil, "slugs of the accounts (default: all accounts), comma separated")
+	flags.String("warn", "", "warning threshold: warning if the balance is below this amount")
+	flags.String("crit", "", "critical threshold: critical if the balance is below this amount")
+	flags.String("threshold-on", "authorized_balance", "balance checked against thresholds: authorized_balance or balance")
+	flags.Bool("sum", false, "sum balances of accounts per currency")
+}
+
+func balance(cmd *cobra.Command, args []string) {
+	format := outputFormat(outputNagios)
+	flags := cmd.Flags()
+	slugs, _ := flags.GetStringSlice("slug")
+	sum, _ := flags.GetBool("sum")
+	var thresholds balanceThresholds
+	thresholds.warn, _ = flags.GetString("warn")
+	thresholds.crit, _ = flags.GetString("crit")
+	thresholds.on, _ = flags.GetString("threshold-on")
+	if err := thresholds.check(); err != nil {
+		balanceUnknown(format, err)
+	}
+
+	Q := newClient()
+	organization, err := Q.GetOrganizationContext(cmd.Context(), viper.GetString("login"))
+	if err != nil {
+		balanceUnknown(format, fmt.Errorf("unable to get organization - %v", err))
+	}
+	reports, err := newBalanceReports(organization, slugs, sum)
+	if err != nil {
+		balanceUnknown(format, err)
+	}
+	status, err := thresholds.apply(reports)
+	if err != nil {
+		balanceUnknown(format, err)
+	}
+
+	switch format {
+	case outputJSON:
+		err = writeJSON(os.Stdout, reports)
+	case outputYAML:
+		err = writeYAML(os.Stdout, reports)
+	case outputNagios:
+		err = writeBalanceNagios(os.Stdout, reports, status, thresholds)
+	default:
+		err = writeBalanceTable(os.Stdout, reports)
+	}
+	if err != nil {
+		balanceUnknown(format, err)
+	}
+	os.Exit(int(status))
+}
+
+// balanceUnknown displays err and exits with the UNKNOWN exit code
+func balanceUnknown(format string, err error) {
+	if format == outputNagios {
+		fmt.Println("QONTO BALANCE UNKNOWN -", err)
+	} else {
+		fmt.Println("ERROR !", err)
+	}
+	os.Exit(int(checkUnknown))
+}
+
+// balanceReport is the balance of an account, or the sum of balances of
+// accounts in a currency (with --sum)
+type balanceReport struct {
+	// Account is the slug of the account (empty for sums)
+	Account string `json:"account,omitempty"`
+	// Accounts are the slugs of the summed accounts (sums only)
+	Accounts          []string    `json:"accounts,omitempty"`
+	Currency          string      `json:"currency"`
+	Balance           qonto.Money `json:"balance"`
+	AuthorizedBalance qonto.Money `json:"authorized_balance"`
+	// Status is set if thresholds are set
+	Status string `json:"status,omitempty"`
+}
+
+// label returns the label of the report (in tables and perfdata)
+func (r *balanceReport) label() string {
+	if r.Account != "" {
+		return r.Account
+	}
+	return "total " + r.Currency
+}
+
+// newBalanceReports returns balance reports for accounts of organization
+// (all if slugs is empty), summed per currency if sum is true
+func newBalanceReports(organization qonto.Organization, slugs []string, sum bool) (reports []*balanceReport, err error) {
+	var accounts []qonto.BankAccount
+	for _, account := range organization.BankAccounts {
+		if len(slugs) == 0 || inStrings(slugs, account.Slug) {
+			accounts = append(accounts, account)
+		}
+	}
+	for _, slug := range slugs {
+		found := false
+		for _, account := range accounts {
+			found = found || account.Slug == slug
+		}
+		if !found {
+			return nil, fmt.Errorf("account %s not found in organization %s", slug, organization.Slug)
+		}
+	}
+
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no bank account found in organization %s", organization.Slug)
+	}
+
+	totals := make(map[string]*balanceReport)
+	for _, account := range accounts {
+		if !sum {
+			reports = append(reports, &balanceReport{
+				Account:           account.Slug,
+				Currency:          account.Currency,
+				Balance:           account.BalanceMoney(),
+				AuthorizedBalance: account.AuthorizedBalanceMoney(),
+			})
+			continue
+		}
+		currency := strings.ToUpper(account.Currency)
+		total, ok := totals[currency]
+		if !ok {
+			total = &balanceReport{
+				Currency:          currency,
+				Balance:           qonto.NewMoney(0, currency),
+				AuthorizedBalance: qonto.NewMoney(0, currency),
+			}
+			totals[currency] = total
+			reports = append(reports, total)
+		}
+		total.Accounts = append(total.Accounts, account.Slug)
+		if total.Balance, err = total.Balance.Add(account.BalanceMoney()); err != nil {
+			return nil, err
+		}
+		if total.AuthorizedBalance, err = total.AuthorizedBalance.Add(account.AuthorizedBalanceMoney()); err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// balanceThresholds are the --warn and --crit thresholds
+type balanceThresholds struct {
+	warn string
+	crit string
+	// on is the balance checked: authorized_balance or balance
+	on string
+}
+
+// isSet returns true if a threshold is set
+func (t balanceThresholds) isSet() bool {
+	return t.warn != "" || t.crit != ""
+}
+
+// check checks thresholds are valid
+func (t balanceThresholds) check() error {
+	if t.on != "authorized_balance" && t.on != "balance" {
+		return fmt.Errorf("invalid --threshold-on %q (expected authorized_balance or balance)", t.on)
+	}
+	for _, threshold := range []string{t.warn, t.crit} {
+		if threshold == "" {
+			continue
+		}
+		if _, err := qonto.ParseMoney(threshold, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value returns the balance of report checked against thresholds
+func (t balanceThresholds) value(report *balanceReport) qonto.Money {
+	if t.on == "balance" {
+		return report.Balance
+	}
+	return report.AuthorizedBalance
+}
+
+// apply sets the status of reports and returns the worst one
+func (t balanceThresholds) apply(reports []*balanceReport) (worst checkStatus, err error) {
+	if !t.isSet() {
+		return checkOK, nil
+	}
+	for _, report := range reports {
+		status := checkOK
+		for _, threshold := range []struct {
+			value  string
+			status checkStatus
+		}{{t.warn, checkWarning}, {t.crit, checkCritical}} {
+			if threshold.value == "" {
+				continue
+			}
+			limit, err := qonto.ParseMoney(threshold.value, report.Currency)
+			if err != nil {
+				return checkUnknown, err
+			}
+			cmp, err := t.value(report).Cmp(limit)
+			if err != nil {
+				return checkUnknown, err
+			}
+			if cmp < 0 && threshold.status > status {
+				status = threshold.status
+			}
+		}
+		report.Status = status.String()
+		if status > worst {
+			worst = status
+		}
+	}
+	return worst, nil
+}
+
+// writeBalanceTable writes reports as a table
+func writeBalanceTable(w io.Writer, reports []*balanceReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACCOUNT\tCURRENCY\tBALANCE\tAUTHORIZED BALANCE\tSTATUS")
+	for _, report := range reports {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", report.label(), report.Currency, report.Balance, report.AuthorizedBalance, report.Status)
+	}
+	return tw.Flush()
+}
+
+// writeBalanceNagios writes reports as a monitoring plugin status line
+// with perfdata ('label'=value;warn;crit;;), thresholds are ranges
+// alerting below the limit ("limit:")
+func writeBalanceNagios(w io.Writer, reports []*balanceReport, status checkStatus, thresholds balanceThresholds) error {
+	var summary, perfdata []string
+	for _, report := range reports {
+		value := thresholds.value(report)
+		summary = append(summary, fmt.Sprintf("%s: %s", report.label(), value))
+		data := fmt.Sprintf("'%s'=%s;", strings.Replace(report.label(), "'", "''", -1), value.Decimal())
+		for i, threshold := range []string{thresholds.warn, thresholds.crit} {
+			if threshold != "" {
+				limit, err := qonto.ParseMoney(threshold, report.Currency)
+				if err != nil {
+					return err
+				}
+				data += limit.Decimal() + ":"
+			}
+			if i == 0 {
+				data += ";"
+			}
+		}
+		perfdata = append(perfdata, data+";;")
+	}
+	_, err := fmt.Fprintf(w, "QONTO BALANCE %s - %s | %s\n", status, strings.Join(summary, ", "), strings.Join(perfdata, " "))
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+func TestBalance(t *testing.T) {
+	organization := qonto.Organization{
+		Slug: "my-orga-42",
+		BankAccounts: []qonto.BankAccount{
+			{Slug: "acc-1", Currency: "EUR", BalanceCents: 900000, AuthorizedBalanceCents: 800000},
+			{Slug: "acc-2", Currency: "EUR", BalanceCents: 300000, AuthorizedBalanceCents: 300000},
+			{Slug: "acc-3", Currency: "USD", BalanceCents: 2000000, AuthorizedBalanceCents: 2000000},
+		},
+	}
+	thresholds := balanceThresholds{warn: "10000", crit: "5000", on: "authorized_balance"}
+	assert.NoError(t, thresholds.check())
+
+	reports, err := newBalanceReports(organization, nil, false)
+	assert.NoError(t, err)
+	status, err := thresholds.apply(reports)
+	assert.NoError(t, err)
+	assert.Equal(t, checkCritical, status)
+	assert.Equal(t, "WARNING", reports[0].Status)
+	assert.Equal(t, "CRITICAL", reports[1].Status)
+	assert.Equal(t, "OK", reports[2].Status)
+
+	var out bytes.Buffer
+	assert.NoError(t, writeBalanceNagios(&out, reports[:1], checkWarning, thresholds))
+	assert.Equal(t, "QONTO BALANCE WARNING - acc-1: 8000.00 EUR | 'acc-1'=8000.00;10000.00:;5000.00:;;\n", out.String())
+
+	// thresholds on balance
+	thresholds.on = "balance"
+	status, err = thresholds.apply(reports[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, checkWarning, status)
+
+	// sums per currency
+	reports, err = newBalanceReports(organization, nil, true)
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, []string{"acc-1", "acc-2"}, reports[0].Accounts)
+		assert.Equal(t, qonto.NewMoney(1200000, "EUR"), reports[0].Balance)
+		assert.Equal(t, qonto.NewMoney(1100000, "EUR"), reports[0].AuthorizedBalance)
+		assert.Equal(t, "total USD", reports[1].label())
+	}
+	status, err = thresholds.apply(reports)
+	assert.NoError(t, err)
+	assert.Equal(t, checkOK, status)
+
+	// only warn
+	out.Reset()
+	thresholds = balanceThresholds{warn: "20000", on: "authorized_balance"}
+	status, err = thresholds.apply(reports)
+	assert.NoError(t, err)
+	assert.Equal(t, checkWarning, status)
+	assert.NoError(t, writeBalanceNagios(&out, reports, status, thresholds))
+	assert.Equal(t, "QONTO BALANCE WARNING - total EUR: 11000.00 EUR, total USD: 20000.00 USD | 'total EUR'=11000.00;20000.00:;;; 'total USD'=20000.00;20000.00:;;;\n", out.String())
+
+	// errors
+	_, err = newBalanceReports(organization, []string{"acc-9"}, false)
+	assert.Error(t, err)
+	assert.Error(t, balanceThresholds{warn: "ten", on: "balance"}.check())
+	assert.Error(t, balanceThresholds{on: "available"}.check())
+}
@@ -0,0 +1,234 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export transactions of an account for a period",
+	Long: `
+Export transactions of an account, settled during a period, to a file (or
+stdout). Use a subcommand to choose the format.
+
+If --slug is not set and your organization has only one bank account, this
+account is used. By default only completed transactions are exported.
+
+The period is a month (--month) or a date range (--from, --to). Dates are in
+the time zone set with --timezone (UTC by default), for the period and for
+exported dates.
+
+Example:
+
+qonto export csv --month 2018-01 --excel-fr --timezone Europe/Paris -f qonto-2018-01.csv
+`,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	// flags shared by export formats, not bound to viper (keys would
+	// collide with the ones of the watch command)
+	flags := exportCmd.PersistentFlags()
+	flags.StringP("slug", "s", "", "slug of the account (default: the bank account of your organization if it has only one)")
+	flags.String("month", "", "month to export (YYYY-MM)")
+	flags.String("from", "", "export transactions settled since this date (YYYY-MM-DD or RFC 3339)")
+	flags.String("to", "", "export transactions settled until this date (YYYY-MM-DD, included, or RFC 3339, default: now)")
+	flags.StringSlice("status", []string{string(qonto.StatusCompleted)}, "statuses of exported transactions, comma separated")
+	flags.StringP("file", "f", "", "file to write (default: stdout)")
+	flags.String("timezone", "UTC", "time zone of dates (Europe/Paris, Local,...)")
+}
+
+// exportRequest is an export of the transactions of an account settled
+// during a period
+type exportRequest struct {
+	ctx     context.Context
+	client  qonto.Client
+	account qonto.BankAccount
+	// From and To are the period (To included)
+	from     time.Time
+	to       time.Time
+	location *time.Location
+	options  qonto.GetTransactionOptions
+}
+
+// newExportRequest returns the export request set by the flags of cmd
+func newExportRequest(cmd *cobra.Command) (e *exportRequest, err error) {
+	flags := cmd.Flags()
+	e = &exportRequest{ctx: cmd.Context()}
+	timezone, _ := flags.GetString("timezone")
+	if e.location, err = time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("invalid time zone %q - %v", timezone, err)
+	}
+	month, _ := flags.GetString("month")
+	from, _ := flags.GetString("from")
+	to, _ := flags.GetString("to")
+	if e.from, e.to, err = parseExportPeriod(month, from, to, e.location); err != nil {
+		return nil, err
+	}
+
+	e.client = newClient()
+	slug, _ := flags.GetString("slug")
+	if e.account, err = findBankAccount(e.ctx, e.client, slug); err != nil {
+		return nil, err
+	}
+	e.options = qonto.GetTransactionOptions{
+		Slug:          e.account.Slug,
+		Iban:          e.account.Iban,
+		SettledAtFrom: e.from,
+		SettledAtTo:   e.to,
+		SortBy:        "settled_at:asc",
+		PerPage:       100,
+	}
+	statuses, _ := flags.GetStringSlice("status")
+	e.options.Status = parseStatuses(statuses)
+	return e, nil
+}
+
+// parseExportPeriod returns the period set by --month or --from/--to
+func parseExportPeriod(month, from, to string, loc *time.Location) (start, end time.Time, err error) {
+	switch {
+	case month != "" && (from != "" || to != ""):
+		return start, end, errors.New("--month can't be used with --from or --to")
+	case month != "":
+		if start, err = time.ParseInLocation("2006-01", month, loc); err != nil {
+			return start, end, fmt.Errorf("invalid month %q (expected YYYY-MM)", month)
+		}
+		return start, start.AddDate(0, 1, 0).Add(-time.Millisecond), nil
+	case from != "":
+		if start, err = parseDateFlag(from, false, loc); err != nil {
+			return start, end, fmt.Errorf("--from: %v", err)
+		}
+		if end, err = parseDateFlag(to, true, loc); err != nil {
+			return start, end, fmt.Errorf("--to: %v", err)
+		}
+		if end.IsZero() {
+			end = time.Now().In(loc)
+		}
+		return start, end, nil
+	}
+	return start, end, errors.New("a period is required (--month or --from)")
+}
+
+// each calls callback for each page of transactions to export
+func (e *exportRequest) each(callback func(transactions []qonto.Transaction) error) error {
+	return e.client.ListAllTransactionsContext(e.ctx, e.options, func(transactions []qonto.Transaction, _ qonto.TransactionsMeta) error {
+		return callback(transactions)
+	})
+}
+
+// all returns all transactions to export
+func (e *exportRequest) all() (transactions []qonto.Transaction, err error) {
+	err = e.each(func(page []qonto.Transaction) error {
+		transactions = append(transactions, page...)
+		return nil
+	})
+	return
+}
+
+// statement returns the statement of the export
+// The closing balance is the current balance minus completed transactions
+// settled after the period.
+func (e *exportRequest) statement() (statement qonto.Statement, err error) {
+	statement = qonto.Statement{
+		Account:        e.account,
+		From:           e.from,
+		To:             e.to,
+		ClosingBalance: e.account.BalanceMoney(),
+		CreatedAt:      time.Now(),
+	}
+	if statement.Transactions, err = e.all(); err != nil {
+		return
+	}
+	if !e.to.Before(statement.CreatedAt) {
+		return
+	}
+	options := e.options
+	options.Status = []qonto.Status{qonto.StatusCompleted}
+	options.SettledAtFrom, options.SettledAtTo = e.to.Add(time.Millisecond), time.Time{}
+	err = e.client.ListAllTransactionsContext(e.ctx, options, func(transactions []qonto.Transaction, _ qonto.TransactionsMeta) (err error) {
+		for _, t := range transactions {
+			if statement.ClosingBalance, err = statement.ClosingBalance.Sub(t.SignedMoney()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// runExport runs the export set by the flags of cmd, write writes it in
+// the format of the subcommand
+// The file is written in a temporary file renamed at the end, so an
+// incomplete export never overwrites a previous one.
+func runExport(cmd *cobra.Command, write func(w io.Writer, e *exportRequest) error) {
+	e, err := newExportRequest(cmd)
+	if err != nil {
+		fmt.Println("ERROR !", err)
+		os.Exit(1)
+	}
+	path, _ := cmd.Flags().GetString("file")
+	if path == "" {
+		if err = write(os.Stdout, e); err != nil {
+			fmt.Println("ERROR !", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err = writeExportFile(path, func(w io.Writer) error { return write(w, e) }); err != nil {
+		fmt.Println("ERROR !", err)
+		os.Exit(1)
+	}
+}
+
+// writeExportFile writes path using write, through a temporary file
+func writeExportFile(path string, write func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	// TempFile creates files readable by owner only
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,62 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// exportCamt053Cmd represents the export camt053 command
+var exportCamt053Cmd = &cobra.Command{
+	Use:   "camt053",
+	Short: "Export transactions as an ISO 20022 camt.053 statement",
+	Long: `
+Export transactions as an ISO 20022 camt.053.001.02 bank to customer
+statement, for ERPs.
+
+Completed transactions are booked entries, pending ones are pending entries
+(use --status completed,pending to export them). Opening and closing
+balances are the balances of the account at the beginning and at the end of
+the period.
+
+Example:
+
+qonto export camt053 --month 2018-01 --timezone Europe/Paris -f qonto-2018-01.xml
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		messageID, _ := cmd.Flags().GetString("message-id")
+		runExport(cmd, func(w io.Writer, e *exportRequest) error {
+			statement, err := e.statement()
+			if err != nil {
+				return err
+			}
+			return qonto.WriteCamt053(w, statement, messageID)
+		})
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportCamt053Cmd)
+	exportCamt053Cmd.Flags().String("message-id", "", "message identification (GrpHdr/MsgId, default: QONTO-creation time)")
+}
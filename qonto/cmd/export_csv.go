@@ -0,0 +1,127 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// exportCSVCmd represents the export csv command
+var exportCSVCmd = &cobra.Command{
+	Use:   "csv",
+	Short: "Export transactions as CSV",
+	Long: `
+Export transactions as CSV.
+
+Columns are set with --columns, available columns are: transaction_id,
+emitted_at, settled_at, status, side, operation_type, amount (negative for
+debits), currency, debit, credit (amount in the debit or credit column),
+local_amount, local_currency, label and note.
+
+Dates are formatted with --date-format, a Go time layout (2006-01-02 for
+ISO dates, 02/01/2006 for French dates,...).
+
+--excel-fr sets options for French versions of Excel: ";" delimiter, ","
+decimal separator, DD/MM/YYYY dates, CRLF line endings and UTF-8 BOM. Other
+flags override them.
+
+Examples:
+
+qonto export csv --month 2018-01 -f qonto-2018-01.csv
+qonto export csv --month 2018-01 --excel-fr --timezone Europe/Paris --columns settled_at,label,debit,credit -f qonto-2018-01.csv
+`,
+	Run: exportCSV,
+}
+
+func init() {
+	exportCmd.AddCommand(exportCSVCmd)
+
+	flags := exportCSVCmd.Flags()
+	flags.String("columns", "", "columns, comma separated (default: transaction_id,emitted_at,settled_at,status,side,operation_type,amount,currency,local_amount,local_currency,label,note)")
+	flags.String("delimiter", ",", `field delimiter ("tab" for tabs)`)
+	flags.String("decimal-separator", ".", "decimal separator of amounts")
+	flags.String("date-format", "2006-01-02T15:04:05Z07:00", "date format (Go time layout)")
+	flags.Bool("no-header", false, "don't write the header line")
+	flags.Bool("crlf", false, "end lines with CRLF")
+	flags.Bool("bom", false, "write a UTF-8 BOM first")
+	flags.Bool("excel-fr", false, "options for French versions of Excel")
+}
+
+func exportCSV(cmd *cobra.Command, args []string) {
+	options, err := csvOptionsFromFlags(cmd)
+	if err != nil {
+		fmt.Println("ERROR !", err)
+		os.Exit(1)
+	}
+	runExport(cmd, func(w io.Writer, e *exportRequest) error {
+		options.Location = e.location
+		cw, err := qonto.NewCSVWriter(w, options)
+		if err != nil {
+			return err
+		}
+		if err = e.each(cw.Write); err != nil {
+			return err
+		}
+		return cw.Flush()
+	})
+}
+
+// csvOptionsFromFlags returns the CSV options set by the flags of cmd
+func csvOptionsFromFlags(cmd *cobra.Command) (options qonto.CSVOptions, err error) {
+	flags := cmd.Flags()
+	if excelFr, _ := flags.GetBool("excel-fr"); excelFr {
+		options = qonto.ExcelFrCSVOptions
+	}
+	if columns, _ := flags.GetString("columns"); columns != "" {
+		if options.Columns, err = qonto.ParseCSVColumns(columns); err != nil {
+			return options, err
+		}
+	}
+	if flags.Changed("delimiter") || options.Delimiter == 0 {
+		delimiter, _ := flags.GetString("delimiter")
+		if strings.EqualFold(delimiter, "tab") {
+			delimiter = "\t"
+		}
+		if utf8.RuneCountInString(delimiter) != 1 {
+			return options, fmt.Errorf("invalid delimiter %q (one character expected)", delimiter)
+		}
+		options.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	}
+	if flags.Changed("decimal-separator") || options.DecimalSeparator == "" {
+		options.DecimalSeparator, _ = flags.GetString("decimal-separator")
+	}
+	if flags.Changed("date-format") || options.DateFormat == "" {
+		options.DateFormat, _ = flags.GetString("date-format")
+	}
+	for flag, option := range map[string]*bool{"no-header": &options.NoHeader, "crlf": &options.UseCRLF, "bom": &options.BOM} {
+		if flags.Changed(flag) || !*option {
+			*option, _ = flags.GetBool(flag)
+		}
+	}
+	return options, nil
+}
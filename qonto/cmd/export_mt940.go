@@ -0,0 +1,67 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// exportMT940Cmd represents the export mt940 command
+var exportMT940Cmd = &cobra.Command{
+	Use:   "mt940",
+	Short: "Export transactions as a SWIFT MT940 statement",
+	Long: `
+Export completed transactions as a SWIFT MT940 customer statement, for
+treasury tools.
+
+Opening (:60F:) and closing (:62F:) balances are the balances of the account
+at the beginning and at the end of the period. Labels and notes are
+transliterated to the SWIFT character set and wrapped to the field lengths.
+
+Example:
+
+qonto export mt940 --month 2018-01 --timezone Europe/Paris --statement-number 1 -f qonto-2018-01.sta
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		var options qonto.MT940Options
+		options.Reference, _ = flags.GetString("reference")
+		options.StatementNumber, _ = flags.GetInt("statement-number")
+		runExport(cmd, func(w io.Writer, e *exportRequest) error {
+			statement, err := e.statement()
+			if err != nil {
+				return err
+			}
+			return qonto.WriteMT940(w, statement, options)
+		})
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportMT940Cmd)
+
+	flags := exportMT940Cmd.Flags()
+	flags.String("reference", "", "statement reference (:20:, default: QONTO followed by the closing date)")
+	flags.Int("statement-number", 1, "statement number (:28C:)")
+}
@@ -0,0 +1,65 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// exportOFXCmd represents the export ofx command
+var exportOFXCmd = &cobra.Command{
+	Use:   "ofx",
+	Short: "Export transactions as an OFX bank statement",
+	Long: `
+Export transactions as an OFX bank statement (OFX 2.2, or OFX 1.0.2 with
+--sgml), to import them in GnuCash, HomeBank, KMyMoney and other accounting
+tools.
+
+The ledger balance is the balance of the account at the end of the period.
+Declined and reversed transactions are not exported.
+
+Examples:
+
+qonto export ofx --month 2018-01 -f qonto-2018-01.ofx
+qonto export ofx --month 2018-01 --sgml -f qonto-2018-01.ofx
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		version := qonto.OFX220
+		if sgml, _ := cmd.Flags().GetBool("sgml"); sgml {
+			version = qonto.OFX102
+		}
+		runExport(cmd, func(w io.Writer, e *exportRequest) error {
+			statement, err := e.statement()
+			if err != nil {
+				return err
+			}
+			return qonto.WriteOFX(w, statement, version)
+		})
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportOFXCmd)
+	exportOFXCmd.Flags().Bool("sgml", false, "generate an OFX 1.0.2 (SGML) file instead of OFX 2.2 (XML)")
+}
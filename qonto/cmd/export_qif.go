@@ -0,0 +1,71 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// exportQIFCmd represents the export qif command
+var exportQIFCmd = &cobra.Command{
+	Use:   "qif",
+	Short: "Export transactions as QIF",
+	Long: `
+Export transactions as QIF (Quicken Interchange Format), for legacy personal
+finance tools.
+
+Dates are US dates (MM/DD/YYYY) by default, use --date-format 02/01/2006 for
+European tools. Completed transactions are flagged as cleared, declined and
+reversed transactions are not exported.
+
+Examples:
+
+qonto export qif --month 2018-01 -f qonto-2018-01.qif
+qonto export qif --month 2018-01 --date-format 02/01/2006 --decimal-separator , -f qonto-2018-01.qif
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		var options qonto.QIFOptions
+		options.DateFormat, _ = flags.GetString("date-format")
+		options.DecimalSeparator, _ = flags.GetString("decimal-separator")
+		options.UseCRLF, _ = flags.GetBool("crlf")
+		runExport(cmd, func(w io.Writer, e *exportRequest) error {
+			transactions, err := e.all()
+			if err != nil {
+				return err
+			}
+			options.Location = e.location
+			return qonto.WriteQIF(w, transactions, options)
+		})
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportQIFCmd)
+
+	flags := exportQIFCmd.Flags()
+	flags.String("date-format", "01/02/2006", "date format (Go time layout)")
+	flags.String("decimal-separator", ".", "decimal separator of amounts")
+	flags.Bool("crlf", false, "end lines with CRLF")
+}
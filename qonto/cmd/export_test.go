@@ -0,0 +1,80 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExportPeriod(t *testing.T) {
+	paris := time.FixedZone("CET", 3600)
+	from, to, err := parseExportPeriod("2018-02", "", "", paris)
+	assert.NoError(t, err)
+	assert.Equal(t, "2018-02-01T00:00:00+01:00", from.Format(time.RFC3339))
+	assert.Equal(t, "2018-02-28T23:59:59.999+01:00", to.Format(time.RFC3339Nano))
+
+	from, to, err = parseExportPeriod("", "2018-01-01", "2018-01-15", time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2018, 1, 15, 23, 59, 59, 999000000, time.UTC), to)
+
+	_, to, err = parseExportPeriod("", "2018-01-01", "", time.UTC)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), to, time.Minute)
+
+	for _, period := range [][3]string{{"", "", ""}, {"2018-01", "2018-01-01", ""}, {"01/2018", "", ""}, {"", "2018-01-32", ""}} {
+		_, _, err = parseExportPeriod(period[0], period[1], period[2], time.UTC)
+		assert.Error(t, err, period)
+	}
+}
+
+func TestWriteExportFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qonto-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.csv")
+
+	assert.NoError(t, writeExportFile(path, func(w io.Writer) error {
+		_, err := fmt.Fprint(w, "v1")
+		return err
+	}))
+	// a failed export doesn't overwrite the previous one
+	assert.Error(t, writeExportFile(path, func(w io.Writer) error {
+		fmt.Fprint(w, "v2")
+		return errors.New("API is down")
+	}))
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(b))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
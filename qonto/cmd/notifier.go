@@ -0,0 +1,216 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// Notifier sends watch events somewhere (log, email, webhook,...)
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// starter is implemented by notifiers which need a background worker,
+// Start is called once by watch before the first event
+type starter interface {
+	// Start starts the worker, wg is done when the worker has stopped
+	Start(ctx context.Context, wg *sync.WaitGroup)
+}
+
+// durableNotifier is implemented by notifiers persisting events before
+// delivery (webhook outbox, digest file). Watch notifies them synchronously, before
+// saving its state, so a crash can't lose events.
+type durableNotifier interface {
+	Notifier
+	durable()
+}
+
+// NotifierFactory builds a Notifier from its settings, settings are the
+// entry of the "notifiers" section of the config file
+type NotifierFactory func(settings *viper.Viper) (Notifier, error)
+
+// notifierFactories is the notifiers registry, by type
+var notifierFactories = make(map[string]NotifierFactory)
+
+// RegisterNotifier registers a notifier type, it can then be used in the
+// "notifiers" section of the config file:
+//
+//	notifiers:
+//	  - name: my-notifier
+//	    type: my-type
+//	    some-setting: value
+func RegisterNotifier(kind string, factory NotifierFactory) {
+	notifierFactories[kind] = factory
+}
+
+func init() {
+	RegisterNotifier("log", func(settings *viper.Viper) (Notifier, error) {
+		return logNotifier{output: viper.GetString("output")}, nil
+	})
+}
+
+// namedNotifier is a Notifier with a name (used in logs and routing)
+type namedNotifier struct {
+	Notifier
+	name string
+}
+
+// notifierKinds returns registered notifier types
+func notifierKinds() (kinds []string) {
+	for kind := range notifierFactories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return
+}
+
+// newNotifier builds a notifier of type kind
+func newNotifier(kind string, settings *viper.Viper) (Notifier, error) {
+	factory, ok := notifierFactories[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier type %q (available types: %v)", kind, notifierKinds())
+	}
+	return factory(settings)
+}
+
+// loadNotifiers builds notifiers defined in the "notifiers" section of the
+// config file (none if the section is missing)
+func loadNotifiers() (notifiers []namedNotifier, err error) {
+	section := viper.Get("notifiers")
+	if section == nil {
+		return nil, nil
+	}
+	entries, err := cast.ToSliceE(section)
+	if err != nil {
+		return nil, fmt.Errorf("config notifiers is invalid - %v", err)
+	}
+	names := make(map[string]bool)
+	for i, entry := range entries {
+		values, err := cast.ToStringMapE(entry)
+		if err != nil {
+			return nil, fmt.Errorf("config notifiers[%d] is invalid - %v", i, err)
+		}
+		settings := viper.New()
+		if err = settings.MergeConfigMap(values); err != nil {
+			return nil, fmt.Errorf("config notifiers[%d] is invalid - %v", i, err)
+		}
+		name := settings.GetString("name")
+		if name == "" {
+			return nil, fmt.Errorf("config notifiers[%d]: name is missing", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("config notifiers: name %s is used twice", name)
+		}
+		names[name] = true
+		notifier, err := newNotifier(settings.GetString("type"), settings)
+		if err != nil {
+			return nil, fmt.Errorf("config notifier %s: %v", name, err)
+		}
+		if digest := settings.GetString("digest"); digest != "" {
+			window, err := parseDigestWindow(digest)
+			if err != nil {
+				return nil, fmt.Errorf("config notifier %s: %v", name, err)
+			}
+			if notifier, err = wrapDigest(notifier, window, digestFilePath(name)); err != nil {
+				return nil, fmt.Errorf("config notifier %s: %v", name, err)
+			}
+		}
+		notifiers = append(notifiers, namedNotifier{Notifier: notifier, name: name})
+	}
+	return notifiers, nil
+}
+
+// splitDurable splits notifiers into durable notifiers and others
+func splitDurable(notifiers []namedNotifier) (durable, others []namedNotifier) {
+	for _, notifier := range notifiers {
+		if _, ok := notifier.Notifier.(durableNotifier); ok {
+			durable = append(durable, notifier)
+		} else {
+			others = append(others, notifier)
+		}
+	}
+	return
+}
+
+// waitTimeout waits for wg, at most timeout, and returns false on timeout
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// notify sends event to all notifiers, errors are logged
+func notify(ctx context.Context, notifiers []namedNotifier, event Event) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, event); err != nil {
+			log.Printf("ERR: notifier %s - %v", notifier.name, err)
+		}
+	}
+}
+
+// logNotifier displays events on stdout
+// With --output json (or yaml) events are written as JSON lines (or YAML
+// documents) using the webhook envelope, logs are still written on stderr.
+type logNotifier struct {
+	output string
+}
+
+// Notify implements Notifier
+func (n logNotifier) Notify(ctx context.Context, event Event) error {
+	switch n.output {
+	case outputJSON:
+		return json.NewEncoder(os.Stdout).Encode(newWebhookEnvelope(event))
+	case outputYAML:
+		var out bytes.Buffer
+		out.WriteString("---\n")
+		if err := writeYAML(&out, newWebhookEnvelope(event)); err != nil {
+			return err
+		}
+		_, err := os.Stdout.Write(out.Bytes())
+		return err
+	}
+	if event.Digest != nil {
+		log.Println(event.Type, "-", event.Digest)
+		return nil
+	}
+	log.Println(event.Type, "-", event.summary())
+	return nil
+}
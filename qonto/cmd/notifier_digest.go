@@ -0,0 +1,353 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	qonto "github.com/toorop/go-qonto"
+)
+
+// EventDigest is the type of digest events
+const EventDigest EventType = "digest"
+
+// digestFlushTimeout is the time given to notifiers to send the last digest
+// on shutdown
+const digestFlushTimeout = 30 * time.Second
+
+// Digest is a summary of the events of a time window
+type Digest struct {
+	From   time.Time
+	To     time.Time
+	Events []Event
+	// BySide and ByOperationType are totals computed on distinct
+	// transactions (last known state), declined and reversed transactions
+	// are not summed
+	BySide          []DigestTotal
+	ByOperationType []DigestTotal
+}
+
+// DigestTotal is the number of transactions and their amounts (one per
+// currency) for a side or an operation type
+type DigestTotal struct {
+	Key     string
+	Count   int
+	Amounts []qonto.Money
+}
+
+// String is a stringer for DigestTotal
+func (t DigestTotal) String() string {
+	amounts := make([]string, len(t.Amounts))
+	for i, amount := range t.Amounts {
+		amounts[i] = amount.String()
+	}
+	return fmt.Sprintf("%s: %d transaction(s) - %s", t.Key, t.Count, strings.Join(amounts, ", "))
+}
+
+// String is a stringer for Digest
+func (d *Digest) String() string {
+	out := fmt.Sprintf("%d event(s) from %s to %s\n", len(d.Events), d.From.Format(time.RFC3339), d.To.Format(time.RFC3339))
+	out += "\nBy side:\n"
+	for _, total := range d.BySide {
+		out += "\t" + total.String() + "\n"
+	}
+	out += "\nBy operation type:\n"
+	for _, total := range d.ByOperationType {
+		out += "\t" + total.String() + "\n"
+	}
+	out += "\nEvents:\n"
+	for _, event := range d.Events {
+		out += "\t" + event.DetectedAt.Format(time.RFC3339) + " " + string(event.Type) + " - " + event.summary() + "\n"
+	}
+	return out
+}
+
+// newDigest returns the digest of events
+func newDigest(from, to time.Time, events []Event) *Digest {
+	d := &Digest{From: from, To: to, Events: events}
+	// last known state of each transaction
+	last := make(map[string]qonto.Transaction)
+	var ids []string
+	for _, event := range events {
+		// balance events
+		if event.Transaction.ID == "" {
+			continue
+		}
+		if _, ok := last[event.Transaction.ID]; !ok {
+			ids = append(ids, event.Transaction.ID)
+		}
+		last[event.Transaction.ID] = event.Transaction
+	}
+	bySide := make(map[string]*digestAccumulator)
+	byOperationType := make(map[string]*digestAccumulator)
+	for _, id := range ids {
+		transaction := last[id]
+		if transaction.Status.IsDeclined() || transaction.Status.IsReversed() {
+			continue
+		}
+		accumulate(bySide, transaction.Side.String(), transaction)
+		accumulate(byOperationType, transaction.OperationType.String(), transaction)
+	}
+	d.BySide = digestTotals(bySide)
+	d.ByOperationType = digestTotals(byOperationType)
+	return d
+}
+
+// digestAccumulator sums amounts of transactions per currency
+type digestAccumulator struct {
+	count   int
+	amounts map[string]qonto.Money
+}
+
+func accumulate(accumulators map[string]*digestAccumulator, key string, transaction qonto.Transaction) {
+	a, ok := accumulators[key]
+	if !ok {
+		a = &digestAccumulator{amounts: make(map[string]qonto.Money)}
+		accumulators[key] = a
+	}
+	a.count++
+	money := transaction.Money()
+	sum, ok := a.amounts[money.Currency]
+	if !ok {
+		sum = qonto.NewMoney(0, money.Currency)
+	}
+	a.amounts[money.Currency], _ = sum.Add(money)
+}
+
+func digestTotals(accumulators map[string]*digestAccumulator) (totals []DigestTotal) {
+	for key, a := range accumulators {
+		total := DigestTotal{Key: key, Count: a.count}
+		for _, amount := range a.amounts {
+			total.Amounts = append(total.Amounts, amount)
+		}
+		sort.Slice(total.Amounts, func(i, j int) bool {
+			return total.Amounts[i].Currency < total.Amounts[j].Currency
+		})
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].Key < totals[j].Key
+	})
+	return
+}
+
+// parseDigestWindow parses a digest window: hourly, daily or a duration
+func parseDigestWindow(value string) (time.Duration, error) {
+	switch value {
+	case "hourly":
+		return time.Hour, nil
+	case "daily":
+		return 24 * time.Hour, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window < time.Minute {
+		return 0, fmt.Errorf("invalid digest window %q (expected hourly, daily or a duration of at least 1m)", value)
+	}
+	return window, nil
+}
+
+// digestNotifier batches events and sends a digest event to notifier at
+// the end of each window. Windows are aligned on UTC (e.g. a daily digest
+// is sent at midnight UTC).
+// If path is set, pending events are persisted in this file and reloaded
+// at startup.
+type digestNotifier struct {
+	notifier Notifier
+	window   time.Duration
+	path     string
+	mu       sync.Mutex
+	from     time.Time
+	events   []Event
+	start    sync.Once
+}
+
+// durableDigestNotifier is a digest notifier persisting its pending events
+type durableDigestNotifier struct {
+	*digestNotifier
+}
+
+// durable implements durableNotifier, events are persisted in the digest
+// file
+func (n durableDigestNotifier) durable() {}
+
+// digestBuffer is the content of the digest file
+type digestBuffer struct {
+	From   time.Time `json:"from"`
+	Events []Event   `json:"events"`
+}
+
+// newDigestNotifier returns a notifier batching events for notifier,
+// pending events are persisted in path (not persisted if path is empty)
+func newDigestNotifier(notifier Notifier, window time.Duration, path string) (*digestNotifier, error) {
+	n := &digestNotifier{
+		notifier: notifier,
+		window:   window,
+		path:     path,
+		from:     time.Now().Truncate(window),
+	}
+	if path == "" {
+		return n, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("digest: unable to create directory - %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("digest: unable to read %s - %v", path, err)
+	}
+	var buffer digestBuffer
+	if err = json.Unmarshal(data, &buffer); err != nil {
+		return nil, fmt.Errorf("digest: unable to read %s - %v", path, err)
+	}
+	if len(buffer.Events) > 0 {
+		n.from, n.events = buffer.From, buffer.Events
+	}
+	return n, nil
+}
+
+// wrapDigest wraps notifier in a digest notifier, durable if pending events
+// are persisted in path
+func wrapDigest(notifier Notifier, window time.Duration, path string) (Notifier, error) {
+	n, err := newDigestNotifier(notifier, window, path)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return n, nil
+	}
+	return durableDigestNotifier{n}, nil
+}
+
+// digestFilePath returns the default digest file of notifier name, next to
+// the state file
+func digestFilePath(name string) string {
+	return filepath.Join(filepath.Dir(stateFilePath()), "qonto-digest", safeFileName(name)+".json")
+}
+
+// Notify implements Notifier, event is added to the current digest
+func (n *digestNotifier) Notify(ctx context.Context, event Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	if err := n.save(); err != nil {
+		return fmt.Errorf("digest: unable to save pending events - %v", err)
+	}
+	return nil
+}
+
+// save writes pending events in the digest file (atomically), n.mu must be
+// held
+func (n *digestNotifier) save() error {
+	if n.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(digestBuffer{From: n.from, Events: n.events})
+	if err != nil {
+		return err
+	}
+	tmp := n.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, n.path)
+}
+
+// Start starts the wrapped notifier (if needed) and the flush loop
+// Pending events are sent when ctx is done.
+func (n *digestNotifier) Start(ctx context.Context, wg *sync.WaitGroup) {
+	n.start.Do(func() {
+		if s, ok := n.notifier.(starter); ok {
+			s.Start(ctx, wg)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.run(ctx)
+		}()
+	})
+}
+
+// run sends a digest at the end of each window until ctx is done
+func (n *digestNotifier) run(ctx context.Context) {
+	for {
+		next := time.Now().Truncate(n.window).Add(n.window)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			flushCtx, cancel := context.WithTimeout(context.Background(), digestFlushTimeout)
+			n.flush(flushCtx, time.Now())
+			cancel()
+			return
+		case <-timer.C:
+			n.flush(ctx, next)
+		}
+	}
+}
+
+// flush sends the digest of pending events (if any)
+// The digest file is only rewritten once the digest has been sent, events
+// are sent again after a crash rather than lost.
+func (n *digestNotifier) flush(ctx context.Context, to time.Time) {
+	n.mu.Lock()
+	events, from := n.events, n.from
+	n.events, n.from = nil, to
+	n.mu.Unlock()
+	if len(events) == 0 {
+		return
+	}
+	defer func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if err := n.save(); err != nil {
+			log.Printf("ERR: unable to save pending digest events - %v", err)
+		}
+	}()
+	event := Event{
+		Type:       EventDigest,
+		DetectedAt: to,
+		Digest:     newDigest(from, to, events),
+	}
+	// all events of a digest share the same account if only one is watched
+	event.Account = events[0].Account
+	for _, e := range events {
+		if e.Account != event.Account {
+			event.Account = ""
+			break
+		}
+	}
+	if err := n.notifier.Notify(ctx, event); err != nil {
+		log.Printf("ERR: unable to send digest - %v", err)
+	}
+}
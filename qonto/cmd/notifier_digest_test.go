@@ -0,0 +1,150 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// recordNotifier records notified events
+type recordNotifier struct {
+	events chan Event
+}
+
+func (n *recordNotifier) Notify(ctx context.Context, event Event) error {
+	n.events <- event
+	return nil
+}
+
+func TestDigest(t *testing.T) {
+	transaction := func(id string, side qonto.Side, operationType qonto.OperationType, status qonto.Status, cents uint64) qonto.Transaction {
+		return qonto.Transaction{ID: id, Side: side, OperationType: operationType, Status: status, AmountCents: cents, Currency: "EUR"}
+	}
+	events := []Event{
+		{Type: EventCreated, Transaction: transaction("t1", qonto.SideDebit, qonto.OperationTypeCard, qonto.StatusPending, 1000)},
+		{Type: EventSettled, Transaction: transaction("t1", qonto.SideDebit, qonto.OperationTypeCard, qonto.StatusCompleted, 1050)},
+		{Type: EventCreated, Transaction: transaction("t2", qonto.SideDebit, qonto.OperationTypeTransfer, qonto.StatusCompleted, 20000)},
+		{Type: EventCreated, Transaction: transaction("t3", qonto.SideCredit, qonto.OperationTypeIncome, qonto.StatusCompleted, 500000)},
+		{Type: EventCreated, Transaction: transaction("t4", qonto.SideDebit, qonto.OperationTypeCard, qonto.StatusDeclined, 999)},
+	}
+	digest := newDigest(time.Time{}, time.Time{}, events)
+	assert.Len(t, digest.Events, 5)
+	assert.Equal(t, []DigestTotal{
+		{Key: "credit", Count: 1, Amounts: []qonto.Money{qonto.NewMoney(500000, "EUR")}},
+		{Key: "debit", Count: 2, Amounts: []qonto.Money{qonto.NewMoney(21050, "EUR")}},
+	}, digest.BySide)
+	assert.Equal(t, []DigestTotal{
+		{Key: "card", Count: 1, Amounts: []qonto.Money{qonto.NewMoney(1050, "EUR")}},
+		{Key: "income", Count: 1, Amounts: []qonto.Money{qonto.NewMoney(500000, "EUR")}},
+		{Key: "transfer", Count: 1, Amounts: []qonto.Money{qonto.NewMoney(20000, "EUR")}},
+	}, digest.ByOperationType)
+}
+
+func TestDigestNotifier(t *testing.T) {
+	for value, expected := range map[string]time.Duration{"hourly": time.Hour, "daily": 24 * time.Hour, "4h": 4 * time.Hour} {
+		window, err := parseDigestWindow(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, window)
+	}
+	for _, value := range []string{"weekly", "10s"} {
+		_, err := parseDigestWindow(value)
+		assert.Error(t, err)
+	}
+
+	// events are flushed in one digest when watch stops, before the
+	// worker is done
+	inner := &recordNotifier{events: make(chan Event, 2)}
+	notifier, err := newDigestNotifier(inner, time.Hour, "")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	notifier.Start(ctx, &workers)
+	for _, id := range []string{"t1", "t2"} {
+		assert.NoError(t, notifier.Notify(ctx, Event{Type: EventCreated, Account: "acc", Transaction: qonto.Transaction{ID: id}}))
+	}
+	cancel()
+	if !waitTimeout(&workers, 5*time.Second) {
+		t.Fatal("digest worker not stopped")
+	}
+	select {
+	case event := <-inner.events:
+		assert.Equal(t, EventDigest, event.Type)
+		if assert.NotNil(t, event.Digest) {
+			assert.Len(t, event.Digest.Events, 2)
+		}
+	default:
+		t.Fatal("digest not flushed")
+	}
+}
+
+func TestDigestNotifierPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qonto-digest", "test.json")
+	inner := &recordNotifier{events: make(chan Event, 2)}
+
+	// only persisted digest notifiers are durable
+	notifier, err := wrapDigest(inner, time.Hour, "")
+	assert.NoError(t, err)
+	durable, _ := splitDurable([]namedNotifier{{Notifier: notifier, name: "memory"}})
+	assert.Empty(t, durable)
+	notifier, err = wrapDigest(inner, time.Hour, path)
+	assert.NoError(t, err)
+	durable, _ = splitDurable([]namedNotifier{{Notifier: notifier, name: "file"}})
+	assert.Len(t, durable, 1)
+
+	// pending events are reloaded by a new notifier (restart)
+	ctx := context.Background()
+	for _, id := range []string{"t1", "t2"} {
+		assert.NoError(t, notifier.Notify(ctx, Event{Type: EventCreated, Account: "acc", Transaction: qonto.Transaction{ID: id, Status: qonto.StatusPending}}))
+	}
+	from := notifier.(durableDigestNotifier).from
+	reloaded, err := newDigestNotifier(inner, time.Hour, path)
+	assert.NoError(t, err)
+	assert.True(t, from.Equal(reloaded.from))
+	if assert.Len(t, reloaded.events, 2) {
+		assert.Equal(t, "t2", reloaded.events[1].Transaction.ID)
+		assert.Equal(t, qonto.StatusPending, reloaded.events[1].Transaction.Status)
+	}
+
+	// the file is emptied once the digest is sent
+	reloaded.flush(ctx, time.Now())
+	select {
+	case event := <-inner.events:
+		assert.Len(t, event.Digest.Events, 2)
+	default:
+		t.Fatal("digest not flushed")
+	}
+	reloaded, err = newDigestNotifier(inner, time.Hour, path)
+	assert.NoError(t, err)
+	assert.Empty(t, reloaded.events)
+
+	// invalid file
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	_, err = newDigestNotifier(inner, time.Hour, path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,394 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// email subject
+	emailSubject = "[QONTO WATCHER] update for transaction %s"
+	// digest email subject
+	emailDigestSubject = "[QONTO WATCHER] digest - %s event(s)"
+	// balance email subject
+	emailBalanceSubject = "[QONTO WATCHER] low authorized balance on %s"
+	// smtp dial timeout
+	smtpTimeout = 30 * time.Second
+)
+
+// SMTP TLS modes
+const (
+	// use STARTTLS if the server supports it (default)
+	smtpTLSAuto = "auto"
+	// require STARTTLS
+	smtpTLSStartTLS = "starttls"
+	// TLS from the start of the connection (SMTPS, port 465)
+	smtpTLSImplicit = "implicit"
+	// no TLS
+	smtpTLSNone = "none"
+)
+
+// default email templates
+var (
+	defaultEmailSubjectTemplate = `{{range .Alerts}}{{.}} {{end}}{{if .Digest}}` + fmt.Sprintf(emailDigestSubject, "{{len .Digest.Events}}") +
+		`{{else if .BankAccount}}` + fmt.Sprintf(emailBalanceSubject, "{{.BankAccount.Slug}}") +
+		`{{else}}` + fmt.Sprintf(emailSubject, "{{.Transaction.ID}}") + `{{end}}`
+	defaultEmailTextTemplate = `{{if .Alerts}}Alerts:{{range .Alerts}} {{.}}{{end}}
+{{end}}{{if .Digest}}Digest{{if .Account}} for account {{.Account}}{{end}}
+{{.Digest}}{{else if .BankAccount}}Event: {{.Type}}
+{{.BankAccount.String}}{{else}}Event: {{.Type}}
+Account: {{.Account}}
+{{if .PreviousStatus}}Previous status: {{.PreviousStatus}}
+{{end}}{{.Transaction.String}}{{end}}`
+	defaultEmailHTMLTemplate = `<html><body>
+{{if .Alerts}}<p>Alerts:{{range .Alerts}} <b>{{.}}</b>{{end}}</p>{{end}}
+{{if .Digest}}{{with .Digest}}
+<h3>{{len .Events}} event(s) from {{.From.Format "2006-01-02 15:04"}} to {{.To.Format "2006-01-02 15:04"}}</h3>
+<h4>By side</h4>
+<ul>{{range .BySide}}<li>{{.}}</li>{{end}}</ul>
+<h4>By operation type</h4>
+<ul>{{range .ByOperationType}}<li>{{.}}</li>{{end}}</ul>
+<h4>Events</h4>
+<table>
+{{range .Events}}<tr><td>{{.DetectedAt.Format "2006-01-02 15:04"}}</td><td>{{.Type}}</td><td>{{.Account}}</td>{{if .BankAccount}}<td colspan="3">authorized balance: {{.BankAccount.AuthorizedBalanceMoney}}</td>{{else}}<td>{{.Transaction.Label}}</td><td>{{.Transaction.SignedMoney}}</td><td>{{.Transaction.Status}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}{{else if .BankAccount}}
+<h3>{{.Type}} - account {{.BankAccount.Slug}}</h3>
+<table>
+<tr><td>IBAN</td><td>{{.BankAccount.Iban}}</td></tr>
+<tr><td>Balance</td><td>{{.BankAccount.BalanceMoney}}</td></tr>
+<tr><td>Authorized balance</td><td>{{.BankAccount.AuthorizedBalanceMoney}}</td></tr>
+</table>
+{{else}}
+<h3>{{.Type}} - transaction {{.Transaction.ID}}</h3>
+<table>
+<tr><td>Account</td><td>{{.Account}}</td></tr>
+<tr><td>Label</td><td>{{.Transaction.Label}}</td></tr>
+<tr><td>Amount</td><td>{{.Transaction.SignedMoney}}</td></tr>
+<tr><td>Operation type</td><td>{{.Transaction.OperationType}}</td></tr>
+<tr><td>Status</td><td>{{.Transaction.Status}}{{if .PreviousStatus}} (was {{.PreviousStatus}}){{end}}</td></tr>
+<tr><td>Emitted at</td><td>{{.Transaction.EmittedAt}}</td></tr>
+<tr><td>Settled at</td><td>{{if .Transaction.SettleAt.Valid}}{{.Transaction.SettleAt}}{{end}}</td></tr>
+<tr><td>Note</td><td>{{.Transaction.Note}}</td></tr>
+</table>
+{{end}}
+</body></html>`
+)
+
+func init() {
+	RegisterNotifier("email", func(settings *viper.Viper) (Notifier, error) {
+		config := emailConfig{
+			To:      settings.GetStringSlice("to"),
+			Subject: settings.GetString("subject_template"),
+			SMTP:    smtpConfigFromViper(),
+		}
+		var err error
+		if config.Text, err = templateSetting(settings, "text_template"); err != nil {
+			return nil, err
+		}
+		if config.HTML, err = templateSetting(settings, "html_template"); err != nil {
+			return nil, err
+		}
+		return newEmailNotifier(config)
+	})
+}
+
+// templateSetting returns the template set inline (key) or in a file
+// (key_file)
+func templateSetting(settings *viper.Viper, key string) (string, error) {
+	if file := settings.GetString(key + "_file"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("email: unable to read %s_file - %v", key, err)
+		}
+		return string(data), nil
+	}
+	return settings.GetString(key), nil
+}
+
+// smtpConfig holds SMTP server settings
+type smtpConfig struct {
+	Host     string
+	Port     string
+	MailFrom string
+	User     string
+	Password string
+	// TLS is the TLS mode: auto, starttls, implicit or none
+	TLS string
+}
+
+// smtpConfigFromViper returns SMTP settings from the smtp section of the
+// config file
+func smtpConfigFromViper() smtpConfig {
+	return smtpConfig{
+		Host:     viper.GetString("smtp.host"),
+		Port:     viper.GetString("smtp.port"),
+		MailFrom: viper.GetString("smtp.mailfrom"),
+		User:     viper.GetString("smtp.user"),
+		Password: viper.GetString("smtp.password"),
+		TLS:      viper.GetString("smtp.tls"),
+	}
+}
+
+// check returns an error if SMTP settings are missing or invalid
+func (c smtpConfig) check() error {
+	for _, setting := range []struct{ key, value string }{{"smtp.host", c.Host}, {"smtp.port", c.Port}, {"smtp.mailfrom", c.MailFrom}} {
+		if setting.value == "" {
+			return fmt.Errorf("config %s is missing. You need to set smtp options in the config file if you want to receive email notification. qonto watch --help for more details", setting.key)
+		}
+	}
+	switch c.TLS {
+	case "", smtpTLSAuto, smtpTLSStartTLS, smtpTLSImplicit, smtpTLSNone:
+	default:
+		return fmt.Errorf("config smtp.tls: invalid value %q (expected auto, starttls, implicit or none)", c.TLS)
+	}
+	return nil
+}
+
+// emailConfig is the configuration of an email notifier
+type emailConfig struct {
+	To []string
+	// Subject, Text and HTML are Go templates (text/template for Subject
+	// and Text, html/template for HTML) executed with the Event,
+	// defaults are used if empty
+	Subject string
+	Text    string
+	HTML    string
+	SMTP    smtpConfig
+}
+
+// emailNotifier sends events by email
+type emailNotifier struct {
+	config  emailConfig
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// newEmailNotifier returns an email notifier
+func newEmailNotifier(config emailConfig) (n *emailNotifier, err error) {
+	if len(config.To) == 0 {
+		return nil, errors.New("email: 'to' is missing")
+	}
+	if err = config.SMTP.check(); err != nil {
+		return nil, err
+	}
+	if config.Subject == "" {
+		config.Subject = defaultEmailSubjectTemplate
+	}
+	if config.Text == "" {
+		config.Text = defaultEmailTextTemplate
+	}
+	if config.HTML == "" {
+		config.HTML = defaultEmailHTMLTemplate
+	}
+	n = &emailNotifier{config: config}
+	if n.subject, err = texttemplate.New("subject").Parse(config.Subject); err != nil {
+		return nil, fmt.Errorf("email: invalid subject template - %v", err)
+	}
+	if n.text, err = texttemplate.New("text").Parse(config.Text); err != nil {
+		return nil, fmt.Errorf("email: invalid text template - %v", err)
+	}
+	if n.html, err = htmltemplate.New("html").Parse(config.HTML); err != nil {
+		return nil, fmt.Errorf("email: invalid html template - %v", err)
+	}
+	return n, nil
+}
+
+// Notify implements Notifier
+func (n *emailNotifier) Notify(ctx context.Context, event Event) error {
+	// templates are executed with a pointer, so methods with pointer
+	// receivers (Transaction.String) can be used
+	var subject, text, html bytes.Buffer
+	if err := n.subject.Execute(&subject, &event); err != nil {
+		return fmt.Errorf("email: unable to render subject - %v", err)
+	}
+	if err := n.text.Execute(&text, &event); err != nil {
+		return fmt.Errorf("email: unable to render text - %v", err)
+	}
+	if err := n.html.Execute(&html, &event); err != nil {
+		return fmt.Errorf("email: unable to render html - %v", err)
+	}
+	msg, err := buildMessage(n.config.SMTP.MailFrom, n.config.To, strings.TrimSpace(subject.String()), text.String(), html.String(), time.Now())
+	if err != nil {
+		return err
+	}
+	if err = sendMail(ctx, n.config.SMTP, n.config.To, msg); err != nil {
+		return fmt.Errorf("unable to send mail - %v", err)
+	}
+	return nil
+}
+
+// buildMessage returns a MIME message with a text and an HTML part
+// (multipart/alternative), html is optional
+func buildMessage(from string, to []string, subject, text, html string, date time.Time) ([]byte, error) {
+	var msg bytes.Buffer
+	messageID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i != -1 {
+		domain = strings.Trim(from[i+1:], "> ")
+	}
+	headers := []string{
+		"From: " + from,
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + date.Format(time.RFC1123Z),
+		"Message-ID: <" + messageID + "@" + domain + ">",
+		"MIME-Version: 1.0",
+	}
+
+	if html == "" {
+		headers = append(headers, "Content-Type: text/plain; charset=utf-8", "Content-Transfer-Encoding: quoted-printable")
+		msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+		if err = writeQuotedPrintable(&msg, text); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err = parts.Close(); err != nil {
+		return nil, err
+	}
+	headers = append(headers, "Content-Type: multipart/alternative; boundary="+parts.Boundary())
+	msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// writeQuotedPrintable writes content quoted-printable encoded to w
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.Replace(content, "\n", "\r\n", -1))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// sendMail sends msg to recipients using SMTP server from config
+func sendMail(ctx context.Context, config smtpConfig, to []string, msg []byte) error {
+	addr := net.JoinHostPort(config.Host, config.Port)
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	tlsConfig := &tls.Config{ServerName: config.Host}
+	var conn net.Conn
+	var err error
+	if config.TLS == smtpTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(smtpTimeout))
+	}
+	c, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if hostname, err := os.Hostname(); err == nil {
+		if err = c.Hello(hostname); err != nil {
+			return err
+		}
+	}
+
+	// STARTTLS
+	if config.TLS != smtpTLSImplicit && config.TLS != smtpTLSNone {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if config.TLS == smtpTLSStartTLS {
+			return errors.New("smtp server doesn't support STARTTLS")
+		}
+	}
+
+	// Auth ?
+	if config.User != "" && config.Password != "" {
+		if err = c.Auth(smtp.PlainAuth("", config.User, config.Password, config.Host)); err != nil {
+			return err
+		}
+	}
+
+	// let's go
+	if err = c.Mail(config.MailFrom); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err = c.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
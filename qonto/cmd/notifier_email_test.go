@@ -0,0 +1,181 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// smtpStandIn is a minimal SMTP server recording received messages
+type smtpStandIn struct {
+	listener   net.Listener
+	recipients []string
+	messages   chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{listener: listener, messages: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.recipients = append(s.recipients, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			reply("250 OK")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.messages <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	server := newSMTPStandIn(t)
+	defer server.listener.Close()
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	notifier, err := newEmailNotifier(emailConfig{
+		To:      []string{"alice@example.com", "bob@example.com"},
+		Subject: "{{.Type}}: {{.Transaction.Label}} {{.Transaction.SignedMoney}}",
+		SMTP: smtpConfig{
+			Host:     host,
+			Port:     port,
+			MailFrom: "qonto@example.com",
+			TLS:      smtpTLSNone,
+		},
+	})
+	assert.NoError(t, err)
+
+	event := Event{
+		Type:    EventCreated,
+		Account: "bank-account-1",
+		Transaction: qonto.Transaction{
+			ID:          "tx-1",
+			AmountCents: 1250,
+			Currency:    "EUR",
+			Side:        qonto.SideDebit,
+			Label:       "Café",
+		},
+		DetectedAt: time.Now(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = notifier.Notify(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw string
+	select {
+	case raw = <-server.messages:
+	case <-ctx.Done():
+		t.Fatal("no message received")
+	}
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, server.recipients)
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	assert.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "created: Café -12.50 EUR", subject)
+	assert.Equal(t, "qonto@example.com", msg.Header.Get("From"))
+	assert.Equal(t, "alice@example.com, bob@example.com", msg.Header.Get("To"))
+	assert.NotEmpty(t, msg.Header.Get("Date"))
+	assert.NotEmpty(t, msg.Header.Get("Message-ID"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var contentTypes []string
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := ioutil.ReadAll(part)
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+		assert.Contains(t, string(body), "tx-1")
+	}
+	assert.Equal(t, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}, contentTypes)
+}
+
+func TestEmailNotifierConfig(t *testing.T) {
+	_, err := newEmailNotifier(emailConfig{SMTP: smtpConfig{Host: "h", Port: "25", MailFrom: "f@example.com"}})
+	assert.EqualError(t, err, "email: 'to' is missing")
+	_, err = newEmailNotifier(emailConfig{To: []string{"a@example.com"}, SMTP: smtpConfig{Host: "h", Port: "25"}})
+	assert.Error(t, err)
+	_, err = newEmailNotifier(emailConfig{To: []string{"a@example.com"}, SMTP: smtpConfig{Host: "h", Port: "25", MailFrom: "f@example.com", TLS: "ssl"}})
+	assert.Error(t, err)
+	_, err = newEmailNotifier(emailConfig{To: []string{"a@example.com"}, Subject: "{{.Foo", SMTP: smtpConfig{Host: "h", Port: "25", MailFrom: "f@example.com"}})
+	assert.Error(t, err)
+}
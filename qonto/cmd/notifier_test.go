@@ -0,0 +1,149 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// setTestConfig loads config (YAML) in the global viper, it is reset at
+// the end of the test
+func setTestConfig(t *testing.T, config string) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("state-file", filepath.Join(t.TempDir(), "state.json"))
+}
+
+// testNotifier is the notifier of the test type
+type testNotifier struct {
+	setting string
+}
+
+func (n testNotifier) Notify(ctx context.Context, event Event) error {
+	return nil
+}
+
+func TestLoadNotifiers(t *testing.T) {
+	RegisterNotifier("test", func(settings *viper.Viper) (Notifier, error) {
+		return testNotifier{setting: settings.GetString("setting")}, nil
+	})
+	t.Cleanup(func() {
+		delete(notifierFactories, "test")
+	})
+	assert.Contains(t, notifierKinds(), "test")
+
+	// no notifiers section
+	setTestConfig(t, "login: my-orga-42\n")
+	notifiers, err := loadNotifiers()
+	assert.NoError(t, err)
+	assert.Empty(t, notifiers)
+
+	setTestConfig(t, `
+notifiers:
+  - name: first
+    type: test
+    setting: foo
+  - name: second
+    type: test
+    digest: hourly
+`)
+	notifiers, err = loadNotifiers()
+	assert.NoError(t, err)
+	if assert.Len(t, notifiers, 2) {
+		assert.Equal(t, "first", notifiers[0].name)
+		assert.Equal(t, testNotifier{setting: "foo"}, notifiers[0].Notifier)
+		// pending events are persisted next to the state file
+		assert.IsType(t, durableDigestNotifier{}, notifiers[1].Notifier)
+		assert.Equal(t, filepath.Join(filepath.Dir(stateFilePath()), "qonto-digest", "second.json"), notifiers[1].Notifier.(durableDigestNotifier).path)
+	}
+
+	// invalid sections
+	for _, config := range []string{
+		"notifiers: foo\n",
+		"notifiers:\n  - foo\n",
+		"notifiers:\n  - type: test\n",
+		"notifiers:\n  - name: n\n    type: unknown\n",
+		"notifiers:\n  - name: n\n    type: test\n  - name: n\n    type: test\n",
+		"notifiers:\n  - name: n\n    type: test\n    digest: never\n",
+	} {
+		setTestConfig(t, config)
+		_, err = loadNotifiers()
+		assert.Error(t, err, config)
+	}
+	setTestConfig(t, "notifiers:\n  - name: n\n    type: unknown\n")
+	_, err = loadNotifiers()
+	assert.Contains(t, err.Error(), `unknown notifier type "unknown"`)
+}
+
+func TestAccountRouting(t *testing.T) {
+	setTestConfig(t, `
+webhook: https://example.com/all
+`)
+	first := namedNotifier{Notifier: testNotifier{setting: "first"}, name: "first"}
+	second := namedNotifier{Notifier: testNotifier{setting: "second"}, name: "second"}
+	routing := &watchRouting{
+		accounts: []watchAccountConfig{
+			{Slug: "acc-1", Statuses: []qonto.Status{qonto.StatusCompleted}, Notifiers: []string{"second"}},
+			{Slug: "acc-2", Webhook: "https://example.com/acc-2"},
+			{Slug: "acc-3", Notifiers: []string{"third"}},
+		},
+		notifiers: []namedNotifier{first, second},
+		inline:    make(map[string]namedNotifier),
+	}
+	names := func(w *accountWatcher) (names []string) {
+		for _, notifier := range w.notifiers {
+			names = append(names, notifier.name)
+		}
+		return
+	}
+
+	w, err := newAccountWatcher(qonto.Client{}, nil, "acc-1", "IBAN1", routing)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log", "webhook:https://example.com/all", "second"}, names(w))
+	assert.Equal(t, []qonto.Status{qonto.StatusCompleted}, w.options.Status)
+
+	w, err = newAccountWatcher(qonto.Client{}, nil, "acc-2", "IBAN2", routing)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log", "webhook:https://example.com/acc-2", "first", "second"}, names(w))
+	assert.Empty(t, w.options.Status)
+
+	// accounts without settings use flags and all notifiers
+	w, err = newAccountWatcher(qonto.Client{}, nil, "acc-4", "IBAN4", routing)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log", "webhook:https://example.com/all", "first", "second"}, names(w))
+	// accounts sharing an URL share the notifier (and its outbox)
+	assert.Len(t, routing.inline, 2)
+	assert.Len(t, routing.all(), 4)
+
+	_, err = newAccountWatcher(qonto.Client{}, nil, "acc-3", "IBAN3", routing)
+	assert.EqualError(t, err, "account acc-3: notifier third is not defined")
+}
@@ -0,0 +1,345 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/spf13/viper"
+	qonto "github.com/toorop/go-qonto"
+)
+
+const (
+	// webhookEnvelopeVersion is the version of the webhook payload format
+	webhookEnvelopeVersion = "1"
+	// webhook HTTP headers
+	webhookHeaderEventID   = "X-Qonto-Watch-Event-Id"
+	webhookHeaderTimestamp = "X-Qonto-Watch-Timestamp"
+	webhookHeaderSignature = "X-Qonto-Watch-Signature"
+	// webhook delivery defaults
+	webhookDefaultTimeout     = 10 * time.Second
+	webhookDefaultMaxAttempts = 20
+	webhookMinBackoff         = 5 * time.Second
+	webhookMaxBackoff         = time.Hour
+)
+
+func init() {
+	RegisterNotifier("webhook", func(settings *viper.Viper) (Notifier, error) {
+		return newWebhookNotifier(webhookConfig{
+			Name:        settings.GetString("name"),
+			URL:         settings.GetString("url"),
+			Secret:      settings.GetString("secret"),
+			Outbox:      settings.GetString("outbox"),
+			MaxAttempts: settings.GetInt("max_attempts"),
+			Timeout:     settings.GetDuration("timeout"),
+		})
+	})
+}
+
+// webhookEnvelope is the payload POSTed to webhooks
+// Transaction is set for transaction events, BankAccount for balance
+// events and Digest for digest events.
+type webhookEnvelope struct {
+	Version        string             `json:"version,omitempty"`
+	ID             string             `json:"id,omitempty"`
+	Type           EventType          `json:"type"`
+	CreatedAt      time.Time          `json:"created_at"`
+	Account        string             `json:"account,omitempty"`
+	PreviousStatus qonto.Status       `json:"previous_status,omitempty"`
+	Transaction    *qonto.Transaction `json:"transaction,omitempty"`
+	BankAccount    *qonto.BankAccount `json:"bank_account,omitempty"`
+	Digest         *webhookDigest     `json:"digest,omitempty"`
+	Alerts         []Alert            `json:"alerts,omitempty"`
+}
+
+// webhookDigest is the digest of a digest event
+type webhookDigest struct {
+	From            time.Time            `json:"from"`
+	To              time.Time            `json:"to"`
+	Events          []webhookEnvelope    `json:"events"`
+	BySide          []webhookDigestTotal `json:"by_side"`
+	ByOperationType []webhookDigestTotal `json:"by_operation_type"`
+}
+
+// webhookDigestTotal is a digest total
+type webhookDigestTotal struct {
+	Key     string        `json:"key"`
+	Count   int           `json:"count"`
+	Amounts []qonto.Money `json:"amounts"`
+}
+
+// newWebhookEnvelope returns the envelope of event (without version and ID)
+func newWebhookEnvelope(event Event) webhookEnvelope {
+	envelope := webhookEnvelope{
+		Type:           event.Type,
+		CreatedAt:      event.DetectedAt.UTC(),
+		Account:        event.Account,
+		PreviousStatus: event.PreviousStatus,
+		BankAccount:    event.BankAccount,
+		Alerts:         event.Alerts,
+	}
+	if event.Digest == nil && event.BankAccount == nil {
+		transaction := event.Transaction
+		envelope.Transaction = &transaction
+	}
+	if event.Digest == nil {
+		return envelope
+	}
+	digest := &webhookDigest{
+		From: event.Digest.From.UTC(),
+		To:   event.Digest.To.UTC(),
+	}
+	for _, e := range event.Digest.Events {
+		digest.Events = append(digest.Events, newWebhookEnvelope(e))
+	}
+	for _, total := range event.Digest.BySide {
+		digest.BySide = append(digest.BySide, webhookDigestTotal(total))
+	}
+	for _, total := range event.Digest.ByOperationType {
+		digest.ByOperationType = append(digest.ByOperationType, webhookDigestTotal(total))
+	}
+	envelope.Digest = digest
+	return envelope
+}
+
+// webhookConfig is the configuration of a webhook notifier
+type webhookConfig struct {
+	// Name is used to name the outbox directory
+	Name string
+	URL  string
+	// Secret is the HMAC-SHA256 key used to sign payloads (optional)
+	Secret string
+	// Outbox is the directory where pending deliveries are stored
+	Outbox      string
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+// webhookNotifier POSTs events as JSON to an URL
+// Events are queued in an on-disk outbox and delivered (with retries) by a
+// background worker, see Start.
+type webhookNotifier struct {
+	config webhookConfig
+	client *http.Client
+	outbox *outbox
+	start  sync.Once
+}
+
+// newWebhookNotifier returns a webhook notifier
+func newWebhookNotifier(config webhookConfig) (*webhookNotifier, error) {
+	if config.URL == "" {
+		return nil, errors.New("webhook: 'url' is missing")
+	}
+	if !govalidator.IsURL(config.URL) {
+		return nil, fmt.Errorf("webhook url %s seems invalid. qonto watch --help for more details", config.URL)
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = webhookDefaultMaxAttempts
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = webhookDefaultTimeout
+	}
+	if config.Outbox == "" {
+		name := config.Name
+		if name == "" {
+			name = config.URL
+		}
+		config.Outbox = filepath.Join(filepath.Dir(stateFilePath()), "qonto-webhook-outbox", safeFileName(name))
+	}
+	box, err := newOutbox(config.Outbox)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: unable to create outbox - %v", err)
+	}
+	return &webhookNotifier{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		outbox: box,
+	}, nil
+}
+
+// Notify implements Notifier, event is queued for delivery
+func (n *webhookNotifier) Notify(ctx context.Context, event Event) error {
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	envelope := newWebhookEnvelope(event)
+	envelope.Version = webhookEnvelopeVersion
+	envelope.ID = id
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return n.outbox.push(&outboxItem{
+		ID:          id,
+		Payload:     payload,
+		CreatedAt:   now,
+		NextAttempt: now,
+	})
+}
+
+// durable implements durableNotifier, events are persisted in the outbox
+func (n *webhookNotifier) durable() {}
+
+// Start starts the delivery worker, it stops when ctx is done
+// Pending deliveries (from a previous run) are sent first.
+func (n *webhookNotifier) Start(ctx context.Context, wg *sync.WaitGroup) {
+	n.start.Do(func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.run(ctx)
+		}()
+	})
+}
+
+// run delivers queued events until ctx is done
+func (n *webhookNotifier) run(ctx context.Context) {
+	for {
+		wait := n.deliverDue(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-n.outbox.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// deliverDue delivers due items and returns the time to wait before the
+// next due item
+func (n *webhookNotifier) deliverDue(ctx context.Context) (wait time.Duration) {
+	wait = webhookMaxBackoff
+	items, err := n.outbox.pending()
+	if err != nil {
+		log.Printf("ERR: webhook %s - unable to read outbox - %v", n.config.URL, err)
+		return webhookMinBackoff
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		if until := time.Until(item.NextAttempt); until > 0 {
+			if until < wait {
+				wait = until
+			}
+			continue
+		}
+		err := n.deliver(ctx, item)
+		if err == nil {
+			if err = n.outbox.remove(item); err != nil {
+				log.Printf("ERR: webhook %s - %v", n.config.URL, err)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			// interrupted, will be retried on next run
+			return
+		}
+		item.Attempts++
+		item.LastError = err.Error()
+		if item.Attempts >= n.config.MaxAttempts {
+			log.Printf("ERR: webhook %s - giving up event %s after %d attempts - %v", n.config.URL, item.ID, item.Attempts, err)
+			if err = n.outbox.fail(item); err != nil {
+				log.Printf("ERR: webhook %s - %v", n.config.URL, err)
+			}
+			continue
+		}
+		backoff := webhookBackoff(item.Attempts)
+		item.NextAttempt = time.Now().Add(backoff)
+		log.Printf("WARN: webhook %s - delivery of event %s failed (attempt %d), retrying in %s - %v", n.config.URL, item.ID, item.Attempts, backoff, err)
+		if err = n.outbox.save(item); err != nil {
+			log.Printf("ERR: webhook %s - %v", n.config.URL, err)
+		}
+		if backoff < wait {
+			wait = backoff
+		}
+	}
+	return
+}
+
+// webhookBackoff returns the wait before attempt+1
+func webhookBackoff(attempts int) time.Duration {
+	wait := webhookMinBackoff
+	for i := 1; i < attempts && wait < webhookMaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > webhookMaxBackoff {
+		wait = webhookMaxBackoff
+	}
+	return wait
+}
+
+// deliver POSTs item payload, any 2xx status is a success
+func (n *webhookNotifier) deliver(ctx context.Context, item *outboxItem) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", n.config.URL, bytes.NewReader(item.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookHeaderEventID, item.ID)
+	req.Header.Set(webhookHeaderTimestamp, timestamp)
+	if n.config.Secret != "" {
+		req.Header.Set(webhookHeaderSignature, "sha256="+signWebhookPayload(n.config.Secret, timestamp, item.Payload))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook call has failed - %s", resp.Status)
+	}
+	return nil
+}
+
+// signWebhookPayload returns hex encoded HMAC-SHA256 of timestamp.payload
+// Receivers should compute the same signature and check the timestamp is
+// recent to prevent replay attacks.
+func signWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
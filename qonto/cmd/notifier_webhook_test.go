@@ -0,0 +1,172 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// webhookReceiver is a webhook endpoint checking signatures, it fails the
+// first failures calls
+type webhookReceiver struct {
+	t        *testing.T
+	secret   string
+	failures int
+
+	mu       sync.Mutex
+	calls    int
+	received []webhookEnvelope
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	payload, _ := ioutil.ReadAll(req.Body)
+	timestamp := req.Header.Get(webhookHeaderTimestamp)
+	assert.Equal(r.t, "application/json", req.Header.Get("Content-Type"))
+	assert.NotEmpty(r.t, timestamp)
+	assert.Equal(r.t, "sha256="+signWebhookPayload(r.secret, timestamp, payload), req.Header.Get(webhookHeaderSignature))
+	if r.calls <= r.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var envelope webhookEnvelope
+	assert.NoError(r.t, json.Unmarshal(payload, &envelope))
+	assert.Equal(r.t, envelope.ID, req.Header.Get(webhookHeaderEventID))
+	r.received = append(r.received, envelope)
+}
+
+// state returns the number of calls and received envelopes
+func (r *webhookReceiver) state() (int, []webhookEnvelope) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls, r.received
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// echo -n '1516262400.{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "1fa84a1104512c27cc53a566340a0c26de5331ccce7bce7391de1ffe5a17f791", signWebhookPayload("secret", "1516262400", []byte(`{"id":"1"}`)))
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, webhookMinBackoff, webhookBackoff(1))
+	assert.Equal(t, 2*webhookMinBackoff, webhookBackoff(2))
+	assert.Equal(t, 8*webhookMinBackoff, webhookBackoff(4))
+	assert.Equal(t, webhookMaxBackoff, webhookBackoff(50))
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	receiver := &webhookReceiver{t: t, secret: "secret", failures: 1}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+	outboxDir := filepath.Join(t.TempDir(), "outbox")
+	config := webhookConfig{URL: ts.URL, Secret: "secret", Outbox: outboxDir}
+	n, err := newWebhookNotifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	durable, others := splitDurable([]namedNotifier{{Notifier: logNotifier{}, name: "log"}, {Notifier: n, name: "webhook"}})
+	assert.Equal(t, []string{"webhook"}, []string{durable[0].name})
+	assert.Len(t, others, 1)
+
+	event := Event{Type: EventCreated, Account: "acc-1", Transaction: qonto.Transaction{ID: "t1", AmountCents: 1000, Currency: "EUR"}, DetectedAt: time.Now()}
+	assert.NoError(t, n.Notify(context.Background(), event))
+
+	// queued events survive restarts
+	n, err = newWebhookNotifier(config)
+	assert.NoError(t, err)
+	items, _ := n.outbox.pending()
+	assert.Len(t, items, 1)
+
+	// first delivery fails: the item is kept with a backoff
+	wait := n.deliverDue(context.Background())
+	assert.Equal(t, webhookMinBackoff, wait)
+	items, _ = n.outbox.pending()
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, 1, items[0].Attempts)
+		assert.Contains(t, items[0].LastError, "503")
+		assert.True(t, items[0].NextAttempt.After(time.Now()))
+	}
+	// not due yet
+	n.deliverDue(context.Background())
+	calls, _ := receiver.state()
+	assert.Equal(t, 1, calls)
+
+	// retry
+	items[0].NextAttempt = time.Now()
+	assert.NoError(t, n.outbox.save(items[0]))
+	n.deliverDue(context.Background())
+	items, _ = n.outbox.pending()
+	assert.Empty(t, items)
+	_, received := receiver.state()
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, webhookEnvelopeVersion, received[0].Version)
+		assert.Equal(t, EventCreated, received[0].Type)
+		assert.Equal(t, "t1", received[0].Transaction.ID)
+	}
+
+	// undeliverable events are moved to the failed directory
+	receiver.mu.Lock()
+	receiver.failures = 10
+	receiver.mu.Unlock()
+	config.MaxAttempts = 1
+	n, err = newWebhookNotifier(config)
+	assert.NoError(t, err)
+	assert.NoError(t, n.Notify(context.Background(), event))
+	n.deliverDue(context.Background())
+	items, _ = n.outbox.pending()
+	assert.Empty(t, items)
+	failed, _ := filepath.Glob(filepath.Join(outboxDir, "failed", "*.json"))
+	assert.Len(t, failed, 1)
+}
+
+func TestWebhookNotifierWorker(t *testing.T) {
+	receiver := &webhookReceiver{t: t, secret: "secret"}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+	n, err := newWebhookNotifier(webhookConfig{URL: ts.URL, Secret: "secret", Outbox: filepath.Join(t.TempDir(), "outbox")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var workers sync.WaitGroup
+	n.Start(ctx, &workers)
+	assert.NoError(t, n.Notify(ctx, Event{Type: EventCreated, Transaction: qonto.Transaction{ID: "t1"}}))
+	assert.Eventually(t, func() bool {
+		_, received := receiver.state()
+		return len(received) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.True(t, waitTimeout(&workers, 5*time.Second))
+}
@@ -22,7 +22,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -34,33 +36,53 @@ var organizationCmd = &cobra.Command{
 	Use:   "organization",
 	Short: "Display your Qonto organizations",
 	Long: `
-Display your Qonto organizations
+Display your Qonto organizations and their bank accounts, as a table, JSON or
+YAML (see --output). JSON and YAML field names are the ones of Qonto API.
 
-Example:
+Examples:
 
 $ qonto organization
-my-orga-42
-                Slug: my-orga-42-bank-account-1
-                IBAN: FR76XXXXXXXXX
-                BIC: XXXXXXXX
-                Currency: EUR
-                Balance (€): 100000000.000000
-                Balance (cents): 10000000000
-                Authorized Balance (€): 0.000000
-                Auhorized Balance (cents): 0
+Organization: my-orga-42
+SLUG                       IBAN           BIC       CURRENCY  BALANCE             AUTHORIZED BALANCE
+my-orga-42-bank-account-1  FR76XXXXXXXXX  XXXXXXXX  EUR       100000000.00 EUR    0.00 EUR
+
+$ qonto organization -o json | jq -r '.bank_accounts[].iban'
+FR76XXXXXXXXX
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
-		Q := qonto.New(viper.GetString("login"), viper.GetString("secret"))
-		organization, err := Q.GetOrganization(viper.GetString("login"))
+		format := outputFormat()
+		Q := newClient()
+		organization, err := Q.GetOrganizationContext(cmd.Context(), viper.GetString("login"))
 		if err != nil {
 			fmt.Println("ERROR ! unable to get organization -", err)
 			os.Exit(1)
 		}
-		fmt.Println(organization)
-
+		switch format {
+		case outputJSON:
+			err = writeJSON(os.Stdout, organization)
+		case outputYAML:
+			err = writeYAML(os.Stdout, organization)
+		default:
+			err = writeOrganizationTable(os.Stdout, organization)
+		}
+		if err != nil {
+			fmt.Println("ERROR !", err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(organizationCmd)
 }
+
+// writeOrganizationTable writes organization and its bank accounts as a table
+func writeOrganizationTable(w io.Writer, organization qonto.Organization) error {
+	fmt.Fprintln(w, "Organization:", organization.Slug)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SLUG\tIBAN\tBIC\tCURRENCY\tBALANCE\tAUTHORIZED BALANCE")
+	for _, account := range organization.BankAccounts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", account.Slug, account.Iban, account.Bic, account.Currency, account.BalanceMoney(), account.AuthorizedBalanceMoney())
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,152 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// outbox is an on-disk queue, one JSON file per item, so pending
+// deliveries survive restarts
+type outbox struct {
+	dir string
+	// wake is signaled when an item is pushed
+	wake chan struct{}
+}
+
+// outboxItem is a pending delivery
+type outboxItem struct {
+	ID          string          `json:"id"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// newOutbox returns an outbox stored in dir (created if needed)
+func newOutbox(dir string) (*outbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &outbox{
+		dir:  dir,
+		wake: make(chan struct{}, 1),
+	}, nil
+}
+
+// push adds item to the outbox
+func (o *outbox) push(item *outboxItem) error {
+	if err := o.save(item); err != nil {
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// save writes item on disk (atomically)
+func (o *outbox) save(item *outboxItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(o.dir, item.ID+".tmp")
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path(item))
+}
+
+// remove deletes item from the outbox
+func (o *outbox) remove(item *outboxItem) error {
+	return os.Remove(o.path(item))
+}
+
+// fail moves item to the failed subdirectory of the outbox
+func (o *outbox) fail(item *outboxItem) error {
+	failedDir := filepath.Join(o.dir, "failed")
+	if err := os.MkdirAll(failedDir, 0700); err != nil {
+		return err
+	}
+	if err := o.save(item); err != nil {
+		return err
+	}
+	return os.Rename(o.path(item), filepath.Join(failedDir, item.ID+".json"))
+}
+
+// pending returns items of the outbox, oldest first
+func (o *outbox) pending() (items []*outboxItem, err error) {
+	files, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		item := new(outboxItem)
+		if err = json.Unmarshal(data, item); err != nil {
+			// corrupted file, skip it
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items, nil
+}
+
+func (o *outbox) path(item *outboxItem) string {
+	return filepath.Join(o.dir, item.ID+".json")
+}
+
+// randomID returns a random hex encoded 128 bits ID
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// safeFileName returns name with characters unsafe for a file name replaced
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,84 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	box, err := newOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2018, 1, 18, 8, 0, 0, 0, time.UTC)
+	first := &outboxItem{ID: "first", Payload: []byte(`{"n":1}`), CreatedAt: createdAt, NextAttempt: createdAt}
+	second := &outboxItem{ID: "second", Payload: []byte(`{"n":2}`), CreatedAt: createdAt.Add(time.Second), NextAttempt: createdAt}
+	assert.NoError(t, box.push(second))
+	assert.NoError(t, box.push(first))
+	// push wakes up the worker
+	select {
+	case <-box.wake:
+	default:
+		t.Error("outbox not woken up")
+	}
+	// corrupted items are skipped
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "corrupted.json"), []byte("{"), 0600))
+
+	// reload: items survive restarts, oldest first
+	box, err = newOutbox(dir)
+	assert.NoError(t, err)
+	items, err := box.pending()
+	assert.NoError(t, err)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, "first", items[0].ID)
+		assert.JSONEq(t, `{"n":1}`, string(items[0].Payload))
+		assert.True(t, createdAt.Equal(items[0].CreatedAt))
+		assert.Equal(t, "second", items[1].ID)
+	}
+
+	// updates
+	first.Attempts, first.LastError = 1, "500 Internal Server Error"
+	assert.NoError(t, box.save(first))
+	items, _ = box.pending()
+	assert.Equal(t, 1, items[0].Attempts)
+	assert.Equal(t, "500 Internal Server Error", items[0].LastError)
+
+	// failed and delivered items leave the queue
+	assert.NoError(t, box.fail(first))
+	assert.NoError(t, box.remove(second))
+	items, _ = box.pending()
+	assert.Empty(t, items)
+	failed, _ := filepath.Glob(filepath.Join(dir, "failed", "*.json"))
+	assert.Equal(t, []string{filepath.Join(dir, "failed", "first.json")}, failed)
+	temporary, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.Empty(t, temporary)
+}
+
+func TestSafeFileName(t *testing.T) {
+	assert.Equal(t, "https___example.com_hook_a_b", safeFileName("https://example.com/hook?a=b"))
+}
@@ -0,0 +1,79 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+func TestOrganizationOutput(t *testing.T) {
+	organization := qonto.Organization{
+		Slug: "my-orga-42",
+		BankAccounts: []qonto.BankAccount{{
+			Slug:                   "my-orga-42-bank-account-1",
+			Iban:                   "FR7612345000010009876543210",
+			Bic:                    "QNTOFRP1XXX",
+			Currency:               "EUR",
+			Balance:                100000000,
+			BalanceCents:           10000000000,
+			AuthorizedBalance:      12.5,
+			AuthorizedBalanceCents: 1250,
+		}},
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, writeJSON(&out, organization))
+	assert.JSONEq(t, `{"slug":"my-orga-42","bank_accounts":[{"slug":"my-orga-42-bank-account-1","iban":"FR7612345000010009876543210","bic":"QNTOFRP1XXX","currency":"EUR","balance":100000000,"balance_cents":10000000000,"authorized_balance":12.5,"authorized_balance_cents":1250}]}`, out.String())
+
+	// same field names and order as JSON, numbers are not turned into floats
+	out.Reset()
+	assert.NoError(t, writeYAML(&out, organization))
+	assert.Equal(t, `slug: my-orga-42
+bank_accounts:
+  - slug: my-orga-42-bank-account-1
+    iban: FR7612345000010009876543210
+    bic: QNTOFRP1XXX
+    currency: EUR
+    balance: 100000000
+    balance_cents: 10000000000
+    authorized_balance: 12.5
+    authorized_balance_cents: 1250
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, writeOrganizationTable(&out, organization))
+	assert.Contains(t, out.String(), "Organization: my-orga-42\n")
+	assert.Contains(t, out.String(), "100000000.00 EUR")
+}
+
+func TestYAMLOutput(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, writeYAML(&out, map[string]interface{}{"string": "123", "empty": []string{}, "null": nil, "ok": true}))
+	assert.Equal(t, `empty: []
+"null": null
+ok: true
+string: "123"
+`, out.String())
+}
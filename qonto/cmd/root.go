@@ -21,12 +21,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	qonto "github.com/toorop/go-qonto"
 )
 
 var cfgFile string
@@ -62,8 +67,11 @@ If you need new commands or features please open an issue on the github reposito
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Commands get a context which is canceled on SIGINT or SIGTERM.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -72,6 +80,8 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file")
+	rootCmd.PersistentFlags().StringP("output", "o", outputTable, "output format: table, json or yaml (some commands support more formats)")
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -108,3 +118,22 @@ func initConfig() {
 		os.Exit(1)
 	}
 }
+
+// newClient returns a Qonto client configured from config/flags
+// Transient errors are retried and, if ratelimit.rps is set, calls are
+// rate limited.
+func newClient() qonto.Client {
+	policy := qonto.DefaultRetryPolicy
+	policy.OnRetry = func(event qonto.RetryEvent) {
+		reason := fmt.Sprintf("HTTP status %d", event.StatusCode)
+		if event.Err != nil {
+			reason = event.Err.Error()
+		}
+		log.Printf("WARN: %s %s failed (%s), retrying in %s", event.Method, event.URL, reason, event.Wait)
+	}
+	options := []qonto.Option{qonto.WithRetryPolicy(policy)}
+	if rps := viper.GetFloat64("ratelimit.rps"); rps > 0 {
+		options = append(options, qonto.WithRateLimit(rps, viper.GetInt("ratelimit.burst")))
+	}
+	return qonto.New(viper.GetString("login"), viper.GetString("secret"), options...)
+}
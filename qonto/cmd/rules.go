@@ -0,0 +1,314 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// Severity is the severity of an alert
+type Severity string
+
+// Severities
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Alert is a rule fired by an event
+type Alert struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+}
+
+// String is a stringer for Alert
+func (a Alert) String() string {
+	return fmt.Sprintf("[%s] %s", a.Severity, a.Rule)
+}
+
+// rule is an alerting rule of the "rules" section of the config file
+// Conditions of a rule are ANDed, conditions not set match everything.
+// A rule is either a transaction rule or a balance rule (authorized
+// balance below a threshold).
+type rule struct {
+	name     string
+	severity Severity
+	accounts []string
+	// transaction conditions
+	events         []string
+	side           string
+	operationTypes []string
+	statuses       []string
+	currency       string
+	abroad         bool
+	label          *regexp.Regexp
+	amountAbove    string
+	// balance condition
+	authorizedBalanceBelow string
+}
+
+// transactionSettings are the settings of transaction rules
+var transactionSettings = []string{"events", "side", "operation_types", "statuses", "abroad", "label", "amount_above"}
+
+// newRule builds a rule from its settings
+func newRule(settings *viper.Viper) (*rule, error) {
+	r := &rule{
+		name:                   settings.GetString("name"),
+		severity:               Severity(strings.ToLower(settings.GetString("severity"))),
+		accounts:               settings.GetStringSlice("accounts"),
+		events:                 settings.GetStringSlice("events"),
+		side:                   strings.ToLower(settings.GetString("side")),
+		operationTypes:         settings.GetStringSlice("operation_types"),
+		statuses:               settings.GetStringSlice("statuses"),
+		currency:               strings.ToUpper(settings.GetString("currency")),
+		abroad:                 settings.GetBool("abroad"),
+		amountAbove:            settings.GetString("amount_above"),
+		authorizedBalanceBelow: settings.GetString("authorized_balance_below"),
+	}
+	switch r.severity {
+	case "":
+		r.severity = SeverityWarning
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return nil, fmt.Errorf("invalid severity %q (expected info, warning or critical)", r.severity)
+	}
+	if r.side != "" && !qonto.Side(r.side).IsKnown() {
+		return nil, fmt.Errorf("invalid side %q", r.side)
+	}
+	if label := settings.GetString("label"); label != "" {
+		var err error
+		if r.label, err = regexp.Compile(label); err != nil {
+			return nil, fmt.Errorf("invalid label regexp - %v", err)
+		}
+	}
+	for _, threshold := range []string{r.amountAbove, r.authorizedBalanceBelow} {
+		if threshold == "" {
+			continue
+		}
+		if _, err := qonto.ParseMoney(threshold, r.currency); err != nil {
+			return nil, err
+		}
+	}
+	if r.isBalanceRule() {
+		for _, key := range transactionSettings {
+			if settings.IsSet(key) {
+				return nil, fmt.Errorf("%s can't be used with authorized_balance_below", key)
+			}
+		}
+	}
+	return r, nil
+}
+
+// isBalanceRule returns true if r is a balance rule
+func (r *rule) isBalanceRule() bool {
+	return r.authorizedBalanceBelow != ""
+}
+
+// matchAccount returns true if r applies to account
+func (r *rule) matchAccount(account string) bool {
+	return len(r.accounts) == 0 || inStrings(r.accounts, account)
+}
+
+// matchEvent returns true if event fires the transaction rule r
+func (r *rule) matchEvent(event Event) (bool, error) {
+	t := event.Transaction
+	switch {
+	case r.isBalanceRule(), !r.matchAccount(event.Account):
+		return false, nil
+	case len(r.events) != 0 && !inStrings(r.events, string(event.Type)):
+		return false, nil
+	case r.side != "" && string(t.Side) != r.side:
+		return false, nil
+	case len(r.operationTypes) != 0 && !inStrings(r.operationTypes, string(t.OperationType)):
+		return false, nil
+	case len(r.statuses) != 0 && !inStrings(r.statuses, string(t.Status)):
+		return false, nil
+	case r.currency != "" && !strings.EqualFold(t.Currency, r.currency):
+		return false, nil
+	case r.abroad && (t.LocalCurrency == "" || strings.EqualFold(t.LocalCurrency, t.Currency)):
+		return false, nil
+	case r.label != nil && !r.label.MatchString(t.Label):
+		return false, nil
+	}
+	if r.amountAbove == "" {
+		return true, nil
+	}
+	threshold, err := qonto.ParseMoney(r.amountAbove, t.Currency)
+	if err != nil {
+		return false, err
+	}
+	cmp, err := t.Money().Cmp(threshold)
+	return cmp > 0, err
+}
+
+// matchBalance returns true if the authorized balance of account is below
+// the threshold of the balance rule r
+func (r *rule) matchBalance(account qonto.BankAccount) (bool, error) {
+	if !r.isBalanceRule() || !r.matchAccount(account.Slug) {
+		return false, nil
+	}
+	if r.currency != "" && !strings.EqualFold(account.Currency, r.currency) {
+		return false, nil
+	}
+	threshold, err := qonto.ParseMoney(r.authorizedBalanceBelow, account.Currency)
+	if err != nil {
+		return false, err
+	}
+	cmp, err := account.AuthorizedBalanceMoney().Cmp(threshold)
+	return cmp < 0, err
+}
+
+// inStrings returns true if value is in values (case insensitive)
+func inStrings(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRules builds rules defined in the "rules" section of the config file
+// (none if the section is missing)
+func loadRules() (rules []*rule, err error) {
+	section := viper.Get("rules")
+	if section == nil {
+		return nil, nil
+	}
+	entries, err := cast.ToSliceE(section)
+	if err != nil {
+		return nil, fmt.Errorf("config rules is invalid - %v", err)
+	}
+	names := make(map[string]bool)
+	for i, entry := range entries {
+		values, err := cast.ToStringMapE(entry)
+		if err != nil {
+			return nil, fmt.Errorf("config rules[%d] is invalid - %v", i, err)
+		}
+		settings := viper.New()
+		if err = settings.MergeConfigMap(values); err != nil {
+			return nil, fmt.Errorf("config rules[%d] is invalid - %v", i, err)
+		}
+		name := settings.GetString("name")
+		if name == "" {
+			return nil, fmt.Errorf("config rules[%d]: name is missing", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("config rules: name %s is used twice", name)
+		}
+		names[name] = true
+		r, err := newRule(settings)
+		if err != nil {
+			return nil, fmt.Errorf("config rule %s: %v", name, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// alerter evaluates rules on events and balances
+// When rules are defined, only events firing a rule are notified (logs
+// excepted).
+type alerter struct {
+	rules []*rule
+	mu    sync.Mutex
+	// below holds account/rule pairs whose balance is below the threshold,
+	// so a balance alert is sent once, when the balance drops below it
+	below map[string]bool
+}
+
+// newAlerter returns an alerter for rules
+func newAlerter(rules []*rule) *alerter {
+	return &alerter{rules: rules, below: make(map[string]bool)}
+}
+
+// enabled returns true if rules are defined
+func (a *alerter) enabled() bool {
+	return a != nil && len(a.rules) != 0
+}
+
+// hasBalanceRules returns true if a balance rule is defined
+func (a *alerter) hasBalanceRules() bool {
+	if a == nil {
+		return false
+	}
+	for _, r := range a.rules {
+		if r.isBalanceRule() {
+			return true
+		}
+	}
+	return false
+}
+
+// eventAlerts returns alerts fired by the transaction event
+func (a *alerter) eventAlerts(event Event) (alerts []Alert) {
+	for _, r := range a.rules {
+		match, err := r.matchEvent(event)
+		if err != nil {
+			log.Printf("ERR: rule %s - %v", r.name, err)
+			continue
+		}
+		if match {
+			alerts = append(alerts, Alert{Rule: r.name, Severity: r.severity})
+		}
+	}
+	return
+}
+
+// balanceEvents returns a balance_below event if the authorized balance of
+// account has dropped below the threshold of some balance rules
+func (a *alerter) balanceEvents(account qonto.BankAccount, now time.Time) (events []Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var alerts []Alert
+	for _, r := range a.rules {
+		match, err := r.matchBalance(account)
+		if err != nil {
+			log.Printf("ERR: rule %s - %v", r.name, err)
+			continue
+		}
+		key := account.Slug + "/" + r.name
+		if match && !a.below[key] {
+			alerts = append(alerts, Alert{Rule: r.name, Severity: r.severity})
+		}
+		a.below[key] = match
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+	return []Event{{
+		Type:        EventBalanceBelow,
+		Account:     account.Slug,
+		BankAccount: &account,
+		DetectedAt:  now,
+		Alerts:      alerts,
+	}}
+}
@@ -0,0 +1,139 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+func testRule(t *testing.T, values map[string]interface{}) *rule {
+	settings := viper.New()
+	assert.NoError(t, settings.MergeConfigMap(values))
+	r, err := newRule(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRules(t *testing.T) {
+	bigDebit := testRule(t, map[string]interface{}{"name": "big-debit", "severity": "critical", "side": "debit", "amount_above": "1000"})
+	cardAbroad := testRule(t, map[string]interface{}{"name": "card-abroad", "operation_types": []string{"card"}, "abroad": true, "events": []string{"created"}})
+	label := testRule(t, map[string]interface{}{"name": "label", "label": "(?i)^urssaf", "accounts": []string{"acc-1"}})
+	alerter := newAlerter([]*rule{bigDebit, cardAbroad, label})
+
+	event := func(account string, transaction qonto.Transaction) Event {
+		if transaction.Currency == "" {
+			transaction.Currency = "EUR"
+		}
+		return Event{Type: EventCreated, Account: account, Transaction: transaction}
+	}
+	assert.Empty(t, alerter.eventAlerts(event("acc-1", qonto.Transaction{Side: qonto.SideDebit, AmountCents: 100000})))
+	assert.Equal(t, []Alert{{Rule: "big-debit", Severity: SeverityCritical}},
+		alerter.eventAlerts(event("acc-1", qonto.Transaction{Side: qonto.SideDebit, AmountCents: 100001})))
+	assert.Empty(t, alerter.eventAlerts(event("acc-1", qonto.Transaction{Side: qonto.SideCredit, AmountCents: 100001})))
+	assert.Equal(t, []Alert{{Rule: "card-abroad", Severity: SeverityWarning}},
+		alerter.eventAlerts(event("acc-1", qonto.Transaction{OperationType: qonto.OperationTypeCard, LocalCurrency: "USD"})))
+	assert.Empty(t, alerter.eventAlerts(event("acc-1", qonto.Transaction{OperationType: qonto.OperationTypeCard, LocalCurrency: "EUR"})))
+	assert.Equal(t, []Alert{{Rule: "label", Severity: SeverityWarning}},
+		alerter.eventAlerts(event("acc-1", qonto.Transaction{Label: "URSSAF Ile de France"})))
+	assert.Empty(t, alerter.eventAlerts(event("acc-2", qonto.Transaction{Label: "URSSAF Ile de France"})))
+
+	// invalid rules
+	for _, values := range []map[string]interface{}{
+		{"name": "severity", "severity": "panic"},
+		{"name": "side", "side": "left"},
+		{"name": "label", "label": "("},
+		{"name": "amount", "amount_above": "ten"},
+		{"name": "balance", "authorized_balance_below": "10", "side": "debit"},
+	} {
+		settings := viper.New()
+		assert.NoError(t, settings.MergeConfigMap(values))
+		_, err := newRule(settings)
+		assert.Error(t, err, values["name"])
+	}
+}
+
+func TestBalanceRules(t *testing.T) {
+	alerter := newAlerter([]*rule{testRule(t, map[string]interface{}{"name": "low-balance", "authorized_balance_below": "500"})})
+	assert.True(t, alerter.hasBalanceRules())
+	account := qonto.BankAccount{Slug: "acc-1", Currency: "EUR", AuthorizedBalanceCents: 60000}
+	assert.Empty(t, alerter.balanceEvents(account, time.Now()))
+
+	// an alert is sent when the balance drops below the threshold, once
+	account.AuthorizedBalanceCents = 49999
+	events := alerter.balanceEvents(account, time.Now())
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, EventBalanceBelow, events[0].Type)
+		assert.Equal(t, "acc-1", events[0].BankAccount.Slug)
+		assert.Equal(t, []Alert{{Rule: "low-balance", Severity: SeverityWarning}}, events[0].Alerts)
+	}
+	assert.Empty(t, alerter.balanceEvents(account, time.Now()))
+
+	account.AuthorizedBalanceCents = 50000
+	assert.Empty(t, alerter.balanceEvents(account, time.Now()))
+	account.AuthorizedBalanceCents = 100
+	assert.Len(t, alerter.balanceEvents(account, time.Now()), 1)
+}
+
+func TestLoadRules(t *testing.T) {
+	// no rules section
+	setTestConfig(t, "login: my-orga-42\n")
+	rules, err := loadRules()
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+	assert.False(t, newAlerter(rules).enabled())
+
+	setTestConfig(t, `
+rules:
+  - name: big-debit
+    side: debit
+    amount_above: "1000"
+  - name: low-balance
+    severity: critical
+    authorized_balance_below: "500"
+`)
+	rules, err = loadRules()
+	assert.NoError(t, err)
+	if assert.Len(t, rules, 2) {
+		alerter := newAlerter(rules)
+		assert.True(t, alerter.enabled())
+		assert.True(t, alerter.hasBalanceRules())
+	}
+
+	// invalid sections
+	for _, config := range []string{
+		"rules: foo\n",
+		"rules:\n  - foo\n",
+		"rules:\n  - side: debit\n",
+		"rules:\n  - name: r\n  - name: r\n",
+		"rules:\n  - name: r\n    side: left\n",
+	} {
+		setTestConfig(t, config)
+		_, err = loadRules()
+		assert.Error(t, err, config)
+	}
+}
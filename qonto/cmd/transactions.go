@@ -0,0 +1,285 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// transactionsCmd represents the transactions command
+var transactionsCmd = &cobra.Command{
+	Use:   "transactions",
+	Short: "List transactions of an account",
+	Long: `
+List transactions of an account as a table, JSON, YAML, NDJSON (one JSON
+transaction per line) or CSV (see --output).
+
+If --slug is not set and your organization has only one bank account, this
+account is used. If --iban is not set, it's found from the slug.
+
+By default only the first page is displayed, use --page and --per-page to
+get other pages or --all to get all transactions.
+
+Examples:
+
+1 - Completed debits of January
+qonto transactions --side debit --status completed --from 2018-01-01 --to 2018-01-31
+
+2 - All card transactions as NDJSON, piped into jq
+qonto transactions --all --operation-type card -o ndjson | jq .label
+
+3 - All transactions of an account as CSV
+qonto transactions --slug my-orga-42-bank-account-1 --all -o csv > transactions.csv
+`,
+	Run: transactions,
+}
+
+func init() {
+	rootCmd.AddCommand(transactionsCmd)
+
+	// flags are not bound to viper, keys would collide with the ones of
+	// the watch command
+	flags := transactionsCmd.Flags()
+	flags.StringP("slug", "s", "", "slug of the account (default: the bank account of your organization if it has only one)")
+	flags.StringP("iban", "i", "", "IBAN of the account (default: found from the slug)")
+	flags.StringSlice("status", nil, "statuses (pending, reversed, declined, completed), comma separated")
+	flags.String("side", "", "side (credit or debit)")
+	flags.StringSlice("operation-type", nil, "operation types (transfer, card, direct_debit, income, qonto_fee, cheque, recall, swift_income), comma separated")
+	flags.String("from", "", "transactions settled since this date (YYYY-MM-DD or RFC 3339)")
+	flags.String("to", "", "transactions settled until this date (YYYY-MM-DD, included, or RFC 3339)")
+	flags.Bool("updated", false, "--from and --to filter on the update date instead of the settlement date")
+	flags.String("sort-by", "", "sort order (settled_at:asc, settled_at:desc, updated_at:asc or updated_at:desc)")
+	flags.Uint16("page", 0, "page to display (default: first page)")
+	flags.Uint16("per-page", 0, "transactions per page (default: API default)")
+	flags.Bool("all", false, "get all pages")
+}
+
+func transactions(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+	flags := cmd.Flags()
+	write := transactionWriters[outputFormat("ndjson", "csv")]
+	options, err := transactionOptionsFromFlags(cmd)
+	if err != nil {
+		fmt.Println("ERROR !", err)
+		os.Exit(1)
+	}
+
+	Q := newClient()
+	if options.Slug, options.Iban, err = resolveAccount(ctx, Q, options.Slug, options.Iban); err != nil {
+		fmt.Println("ERROR !", err)
+		os.Exit(1)
+	}
+
+	var list []qonto.Transaction
+	var meta qonto.TransactionsMeta
+	if all, _ := flags.GetBool("all"); all {
+		err = Q.ListAllTransactionsContext(ctx, options, func(page []qonto.Transaction, _ qonto.TransactionsMeta) error {
+			list = append(list, page...)
+			return nil
+		})
+	} else {
+		list, meta, err = Q.GetTransactionsPageContext(ctx, options)
+	}
+	if err != nil {
+		fmt.Println("ERROR ! unable to get transactions -", err)
+		os.Exit(1)
+	}
+	if err = write(os.Stdout, list); err != nil {
+		fmt.Println("ERROR !", err)
+		os.Exit(1)
+	}
+	// on stderr to not break pipes
+	if meta.HasNextPage() {
+		fmt.Fprintf(os.Stderr, "page %d/%d (%d transactions), use --page or --all to get more\n", meta.CurrentPage, meta.TotalPages, meta.TotalCount)
+	}
+}
+
+// parseStatuses returns values as transaction statuses
+func parseStatuses(values []string) (statuses []qonto.Status) {
+	for _, value := range values {
+		statuses = append(statuses, qonto.Status(value))
+	}
+	return
+}
+
+// transactionOptionsFromFlags returns the GetTransactionOptions set by
+// the flags of cmd
+func transactionOptionsFromFlags(cmd *cobra.Command) (options qonto.GetTransactionOptions, err error) {
+	flags := cmd.Flags()
+	options.Slug, _ = flags.GetString("slug")
+	options.Iban, _ = flags.GetString("iban")
+	statuses, _ := flags.GetStringSlice("status")
+	options.Status = parseStatuses(statuses)
+	side, _ := flags.GetString("side")
+	options.Side = qonto.Side(side)
+	operationTypes, _ := flags.GetStringSlice("operation-type")
+	for _, operationType := range operationTypes {
+		options.OperationType = append(options.OperationType, qonto.OperationType(operationType))
+	}
+	options.SortBy, _ = flags.GetString("sort-by")
+	options.CurrentPage, _ = flags.GetUint16("page")
+	options.PerPage, _ = flags.GetUint16("per-page")
+
+	var from, to time.Time
+	value, _ := flags.GetString("from")
+	if from, err = parseDateFlag(value, false, time.UTC); err != nil {
+		return options, fmt.Errorf("--from: %v", err)
+	}
+	value, _ = flags.GetString("to")
+	if to, err = parseDateFlag(value, true, time.UTC); err != nil {
+		return options, fmt.Errorf("--to: %v", err)
+	}
+	if updated, _ := flags.GetBool("updated"); updated {
+		options.UpdatedAtFrom, options.UpdatedAtTo = from, to
+	} else {
+		options.SettledAtFrom, options.SettledAtTo = from, to
+	}
+	return options, nil
+}
+
+// parseDateFlag parses a date (YYYY-MM-DD, in loc) or a time (RFC 3339)
+// If end is true, a date is the end of the day.
+func parseDateFlag(value string, end bool, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1).Add(-time.Millisecond)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q (expected YYYY-MM-DD or RFC 3339)", value)
+	}
+	return t, nil
+}
+
+// resolveAccount returns slug and IBAN of the account, missing ones are
+// found in the organization
+func resolveAccount(ctx context.Context, Q qonto.Client, slug, iban string) (string, string, error) {
+	if slug != "" && iban != "" {
+		return slug, iban, nil
+	}
+	account, err := findBankAccount(ctx, Q, slug)
+	return account.Slug, account.Iban, err
+}
+
+// findBankAccount returns the bank account slug of the organization, or
+// its only bank account if slug is empty
+func findBankAccount(ctx context.Context, Q qonto.Client, slug string) (qonto.BankAccount, error) {
+	organization, err := Q.GetOrganizationContext(ctx, viper.GetString("login"))
+	if err != nil {
+		return qonto.BankAccount{}, fmt.Errorf("unable to get organization - %v", err)
+	}
+	if slug == "" {
+		if len(organization.BankAccounts) != 1 {
+			return qonto.BankAccount{}, fmt.Errorf("your organization has %d bank accounts, --slug is required", len(organization.BankAccounts))
+		}
+		return organization.BankAccounts[0], nil
+	}
+	for _, account := range organization.BankAccounts {
+		if account.Slug == slug {
+			return account, nil
+		}
+	}
+	return qonto.BankAccount{}, fmt.Errorf("account %s not found in organization %s", slug, organization.Slug)
+}
+
+// transactionWriters are the output formats of the transactions command
+var transactionWriters = map[string]func(w io.Writer, transactions []qonto.Transaction) error{
+	"table":  writeTransactionsTable,
+	"json":   writeTransactionsJSON,
+	"yaml":   writeTransactionsYAML,
+	"ndjson": writeTransactionsNDJSON,
+	"csv":    writeTransactionsCSV,
+}
+
+// formatQtime formats t for tables and CSV, empty if not set
+func formatQtime(t qonto.Qtime, layout string) string {
+	if !t.Valid() {
+		return ""
+	}
+	return t.UTC().Format(layout)
+}
+
+// writeTransactionsTable writes transactions as a table
+func writeTransactionsTable(w io.Writer, transactions []qonto.Transaction) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMITTED AT\tSETTLED AT\tSTATUS\tSIDE\tOPERATION TYPE\tAMOUNT\tLABEL")
+	for _, t := range transactions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.ID,
+			formatQtime(t.EmittedAt, "2006-01-02 15:04"),
+			formatQtime(t.SettleAt, "2006-01-02 15:04"),
+			t.Status, t.Side, t.OperationType,
+			t.SignedMoney(),
+			strings.Join(strings.Fields(t.Label), " "),
+		)
+	}
+	return tw.Flush()
+}
+
+// writeTransactionsJSON writes transactions as a JSON array
+func writeTransactionsJSON(w io.Writer, transactions []qonto.Transaction) error {
+	if transactions == nil {
+		transactions = []qonto.Transaction{}
+	}
+	return writeJSON(w, transactions)
+}
+
+// writeTransactionsYAML writes transactions as a YAML sequence
+func writeTransactionsYAML(w io.Writer, transactions []qonto.Transaction) error {
+	if transactions == nil {
+		transactions = []qonto.Transaction{}
+	}
+	return writeYAML(w, transactions)
+}
+
+// writeTransactionsNDJSON writes transactions as JSON, one per line
+func writeTransactionsNDJSON(w io.Writer, transactions []qonto.Transaction) error {
+	encoder := json.NewEncoder(w)
+	for _, t := range transactions {
+		if err := encoder.Encode(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTransactionsCSV writes transactions as CSV, with a header
+// Amounts are signed decimals (negative for debits), see export csv for
+// more options.
+func writeTransactionsCSV(w io.Writer, transactions []qonto.Transaction) error {
+	return qonto.WriteTransactionsCSV(w, transactions, qonto.CSVOptions{})
+}
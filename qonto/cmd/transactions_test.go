@@ -0,0 +1,76 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+func TestTransactionWriters(t *testing.T) {
+	emittedAt, _ := qonto.ParseQtime("2018-01-18T06:46:12.000Z")
+	transactions := []qonto.Transaction{
+		{ID: "t1", AmountCents: 1050, LocalAmountCents: 1200, Currency: "EUR", LocalCurrency: "USD", Side: qonto.SideDebit, OperationType: qonto.OperationTypeCard, Status: qonto.StatusPending, EmittedAt: emittedAt, Label: "Coffee, \"large\""},
+		{ID: "t2", AmountCents: 500000, LocalAmountCents: 500000, Currency: "EUR", LocalCurrency: "EUR", Side: qonto.SideCredit, OperationType: qonto.OperationTypeIncome, Status: qonto.StatusCompleted, EmittedAt: emittedAt, SettleAt: emittedAt, Label: "Invoice 42"},
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, writeTransactionsCSV(&out, transactions))
+	assert.Equal(t, `transaction_id,emitted_at,settled_at,status,side,operation_type,amount,currency,local_amount,local_currency,label,note
+t1,2018-01-18T06:46:12Z,,pending,debit,card,-10.50,EUR,-12.00,USD,"Coffee, ""large""",
+t2,2018-01-18T06:46:12Z,2018-01-18T06:46:12Z,completed,credit,income,5000.00,EUR,5000.00,EUR,Invoice 42,
+`, out.String())
+
+	out.Reset()
+	assert.NoError(t, writeTransactionsNDJSON(&out, transactions))
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, string(lines[0]), `"transaction_id":"t1"`)
+		assert.Contains(t, string(lines[0]), `"settled_at":null`)
+	}
+
+	out.Reset()
+	assert.NoError(t, writeTransactionsJSON(&out, nil))
+	assert.Equal(t, "[]\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, writeTransactionsTable(&out, transactions))
+	assert.Contains(t, out.String(), "-10.50 EUR")
+	assert.Contains(t, out.String(), "2018-01-18 06:46")
+}
+
+func TestParseDateFlag(t *testing.T) {
+	from, err := parseDateFlag("2018-01-31", false, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 1, 31, 0, 0, 0, 0, time.UTC), from)
+	to, err := parseDateFlag("2018-01-31", true, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 1, 31, 23, 59, 59, 999000000, time.UTC), to)
+	at, err := parseDateFlag("2018-01-31T10:00:00+01:00", true, time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, at.Equal(time.Date(2018, 1, 31, 9, 0, 0, 0, time.UTC)))
+	_, err = parseDateFlag("31/01/2018", false, time.UTC)
+	assert.Error(t, err)
+}
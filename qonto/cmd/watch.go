@@ -21,24 +21,30 @@
 package cmd
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"net/http"
-	"net/smtp"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/asaskevich/govalidator"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	qonto "github.com/toorop/go-qonto"
 )
 
 const (
-	// email subject
-	emailSubject = "[QONTO WATCHER] update for transaction %s"
+	// time between two polls
+	watchInterval = 60 * time.Second
+	// transactions updated since last poll minus this margin are fetched,
+	// to not miss updates because of clock skew
+	watchPollMargin = 5 * time.Minute
+	// transactions in a final status (settled, declined or reversed) are
+	// dropped from the state when they have not been returned by polls for
+	// watchPollMargin plus this retention
+	watchStateRetention = 30 * 24 * time.Hour
 )
 
 // watchCmd represents the watch command
@@ -52,6 +58,15 @@ Watch an account and for each new transation (or transaction update):
 - send an email (optional)
 - call a webhook (optional)
 
+Events are: created, status_changed, updated, settled and reversed.
+With --output json (or yaml), events are written on stdout as JSON lines (or
+YAML documents) using the webhook envelope format.
+Seen transactions are saved in a state file (see --state-file), so watch can
+be restarted without losing or duplicating events. On first run, watch takes a
+snapshot of the account and doesn't notify existing transactions. Settled,
+declined and reversed transactions are dropped from the state when they have
+not been updated for 30 days.
+
 If you want to recieve email notifications, you have ton setup "smtp" section on the config file.
 
 Examples:
@@ -65,6 +80,17 @@ qonto watch --slug account-slug --iban IBAN --webhook https://qonto.toorop.fr/
 3 - Receive email notification and call a webhook (Amazing !)
 qonto watch --slug account-slug --iban IBAN --email toorop@gmail.com --webhook https://qonto.toorop.fr/
 
+4 - Watch all the bank accounts of your organization
+qonto watch --all --email toorop@gmail.com
+
+Per-account statuses, email and webhook can be defined in the "watch.accounts"
+section of the config file, they override flags.
+
+When alerting rules are defined in the "rules" section of the config file
+(debit above an amount, card payment abroad, label matching a regexp,
+authorized balance below a threshold,...), only events firing a rule are
+notified, tagged with the rule name and severity.
+
 
 
 
@@ -75,131 +101,444 @@ qonto watch --slug account-slug --iban IBAN --email toorop@gmail.com --webhook h
 func init() {
 	rootCmd.AddCommand(watchCmd)
 
+	// all accounts
+	watchCmd.Flags().Bool("all", false, "watch all bank accounts of your organization")
+	viper.BindPFlag("all", watchCmd.Flags().Lookup("all"))
+
 	// slug (required)
-	watchCmd.Flags().StringP("slug", "s", "", "slug of the account to be watched (required)")
+	watchCmd.Flags().StringP("slug", "s", "", "slug of the account to be watched (required without --all)")
 	viper.BindPFlag("slug", watchCmd.Flags().Lookup("slug"))
 
 	// iban (required)
-	watchCmd.Flags().StringP("iban", "i", "", "IBAN of the account to be watched (required)")
+	watchCmd.Flags().StringP("iban", "i", "", "IBAN of the account to be watched (required without --all)")
 	viper.BindPFlag("iban", watchCmd.Flags().Lookup("iban"))
 
 	// statuses
-	watchCmd.Flags().StringSlice("statuses", []string{"pending", "reversed", "declined", "completed"}, "statuses you want to bind. Example: --status \"reversed declined\" . By default all type of transactions are watched.")
+	watchCmd.Flags().StringSlice("statuses", []string{"pending", "reversed", "declined", "completed"}, "statuses you want to bind. Example: --statuses reversed,declined . By default all type of transactions are watched.")
 	viper.BindPFlag("statuses", watchCmd.Flags().Lookup("statuses"))
 
 	// email
-	watchCmd.Flags().StringP("email", "m", "", "email addresse where watcher will send notification on change")
+	watchCmd.Flags().StringP("email", "m", "", "email addresses (comma separated) where watcher will send notification on change")
 	viper.BindPFlag("send-email-to", watchCmd.Flags().Lookup("email"))
 
 	// webhook
 	watchCmd.Flags().StringP("webhook", "w", "", "Webhook URL")
 	viper.BindPFlag("webhook", watchCmd.Flags().Lookup("webhook"))
+
+	// webhook secret
+	watchCmd.Flags().String("webhook-secret", "", "secret used to sign webhook payloads (HMAC-SHA256)")
+	viper.BindPFlag("webhook-secret", watchCmd.Flags().Lookup("webhook-secret"))
+
+	// digest
+	watchCmd.Flags().String("digest", "", "send a digest of events every window (hourly, daily or a duration like 4h) by email and webhook instead of one notification per event")
+	viper.BindPFlag("digest", watchCmd.Flags().Lookup("digest"))
+
+	// state file
+	watchCmd.Flags().String("state-file", "", "file where seen transactions are saved (default: qonto-watch-state.json in the same path as qonto binary)")
+	viper.BindPFlag("state-file", watchCmd.Flags().Lookup("state-file"))
+}
+
+// watchAccountConfig holds the per-account settings of the config file
+// (watch.accounts section)
+type watchAccountConfig struct {
+	Slug     string         `mapstructure:"slug"`
+	Statuses []qonto.Status `mapstructure:"statuses"`
+	Email    string         `mapstructure:"email"`
+	Webhook  string         `mapstructure:"webhook"`
+	// Notifiers are the names of the notifiers (from the notifiers
+	// section) events of this account are routed to, all if empty
+	Notifiers []string `mapstructure:"notifiers"`
 }
 
 func watch(cmd *cobra.Command, args []string) {
-	// check flags
+	ctx := cmd.Context()
+	outputFormat()
+	Q := newClient()
 
-	// slug
-	if viper.GetString("slug") == "" {
-		fmt.Println("--slug option is required. qonto watch --help for more details.")
+	// per-account settings
+	var accountsConfig []watchAccountConfig
+	if err := viper.UnmarshalKey("watch.accounts", &accountsConfig); err != nil {
+		fmt.Println("config watch.accounts is invalid -", err)
 		os.Exit(1)
 	}
 
-	// iban
-	if viper.GetString("iban") == "" {
-		fmt.Println("--iban option is required. qonto watch --help for more details.")
+	// notifiers
+	notifiers, err := loadNotifiers()
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	// if email, check that at least smtp.host and smtp.port are set
-	if viper.GetString("send-email-to") != "" {
-		if viper.GetString("smtp.host") == "" {
-			fmt.Println("config smtp.host is missing. You need to set smtp options in the config file if you want to receive email notification. qonto watch --help for more details.")
+	// rules
+	rules, err := loadRules()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// state
+	state, err := loadWatchState(stateFilePath())
+	if err != nil {
+		fmt.Println("unable to load watch state -", err)
+		os.Exit(1)
+	}
+
+	routing := &watchRouting{
+		accounts:  accountsConfig,
+		notifiers: notifiers,
+		inline:    make(map[string]namedNotifier),
+		alerter:   newAlerter(rules),
+	}
+	if digest := viper.GetString("digest"); digest != "" {
+		if routing.digestWindow, err = parseDigestWindow(digest); err != nil {
+			fmt.Println(err)
 			os.Exit(1)
 		}
-		if viper.GetString("smtp.port") == "" {
-			fmt.Println("config smtp.port is missing. You need to set smtp options in the config file if you want to receive email notification. qonto watch --help for more details.")
+	}
+	var watchers []*accountWatcher
+	if viper.GetBool("all") {
+		watchers, err = organizationWatchers(ctx, Q, state, routing)
+	} else {
+		// slug
+		if viper.GetString("slug") == "" {
+			fmt.Println("--slug option is required (or --all). qonto watch --help for more details.")
 			os.Exit(1)
 		}
-		if viper.GetString("smtp.mailfrom") == "" {
-			fmt.Println("config smtp.mailfrom is missing. You need to set smtp options in the config file if you want to receive email notification. qonto watch --help for more details.")
+
+		// iban
+		if viper.GetString("iban") == "" {
+			fmt.Println("--iban option is required (or --all). qonto watch --help for more details.")
 			os.Exit(1)
 		}
+		var w *accountWatcher
+		w, err = newAccountWatcher(Q, state, viper.GetString("slug"), viper.GetString("iban"), routing)
+		watchers = append(watchers, w)
+	}
+	if err != nil {
+		fmt.Println("ERROR !", err)
+		os.Exit(1)
 	}
 
-	// if webhook check url
-	if viper.GetString("webhook") != "" {
-		if !govalidator.IsURL(viper.GetString("webhook")) {
-			fmt.Println("webhook url seems invalid. qonto watch --help for more details.")
-			os.Exit(1)
+	// start notifiers workers (webhook deliveries,...)
+	var workers sync.WaitGroup
+	for _, notifier := range routing.all() {
+		if s, ok := notifier.Notifier.(starter); ok {
+			s.Start(ctx, &workers)
 		}
 	}
 
-	Q := qonto.New(viper.GetString("login"), viper.GetString("secret"))
-	options := qonto.GetTransactionOptions{
-		Slug:   viper.GetString("slug"),
-		Iban:   viper.GetString("iban"),
-		Status: viper.GetStringSlice("statuses"),
+	var wg sync.WaitGroup
+	for _, w := range watchers {
+		log.Println("watching account", w.options.Slug)
+		wg.Add(1)
+		go func(w *accountWatcher) {
+			defer wg.Done()
+			w.run(ctx)
+		}(w)
 	}
-	// Warning this basic algo will fail if you have more than 100 transacs per minute
-	// if it's the case contact me, i will solve your problem for less than one minute.
-	tac := time.Now()
-	var tic time.Time
-	for {
-		// let's start by a little snap
-		time.Sleep(60 * time.Second)
-		// get last transactions
+	wg.Wait()
+	// notifiers workers send pending digests when ctx is done
+	if !waitTimeout(&workers, digestFlushTimeout) {
+		log.Println("WARN: notifiers have not stopped in time, pending notifications may be lost")
+	}
+}
+
+// watchRouting holds what is needed to route events of accounts to notifiers
+type watchRouting struct {
+	// accounts are per-account settings (watch.accounts section)
+	accounts []watchAccountConfig
+	// notifiers are the notifiers of the notifiers section
+	notifiers []namedNotifier
+	// inline are notifiers built from --email/--webhook flags and
+	// watch.accounts, by recipient/URL, so accounts sharing a recipient
+	// share the notifier
+	inline map[string]namedNotifier
+	// digestWindow is the --digest window (0 if not set)
+	digestWindow time.Duration
+	// alerter evaluates rules of the rules section
+	alerter *alerter
+}
+
+// email returns the email notifier sending mails to recipients (comma
+// separated)
+func (r *watchRouting) email(recipients string) (namedNotifier, error) {
+	key := "email:" + recipients
+	if notifier, ok := r.inline[key]; ok {
+		return notifier, nil
+	}
+	var to []string
+	for _, recipient := range strings.Split(recipients, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			to = append(to, recipient)
+		}
+	}
+	notifier, err := newEmailNotifier(emailConfig{
+		To:   to,
+		SMTP: smtpConfigFromViper(),
+	})
+	if err != nil {
+		return namedNotifier{}, err
+	}
+	wrapped, err := r.digest(notifier, key)
+	if err != nil {
+		return namedNotifier{}, err
+	}
+	r.inline[key] = namedNotifier{Notifier: wrapped, name: key}
+	return r.inline[key], nil
+}
 
-		transactions, err := Q.GetTransactions(options)
+// webhook returns the webhook notifier calling url
+func (r *watchRouting) webhook(url string) (namedNotifier, error) {
+	key := "webhook:" + url
+	if notifier, ok := r.inline[key]; ok {
+		return notifier, nil
+	}
+	notifier, err := newWebhookNotifier(webhookConfig{
+		URL:    url,
+		Secret: viper.GetString("webhook-secret"),
+	})
+	if err != nil {
+		return namedNotifier{}, err
+	}
+	wrapped, err := r.digest(notifier, key)
+	if err != nil {
+		return namedNotifier{}, err
+	}
+	r.inline[key] = namedNotifier{Notifier: wrapped, name: key}
+	return r.inline[key], nil
+}
+
+// digest wraps notifier in a digest notifier if --digest is set, pending
+// events are persisted in the digest file of name
+func (r *watchRouting) digest(notifier Notifier, name string) (Notifier, error) {
+	if r.digestWindow == 0 {
+		return notifier, nil
+	}
+	return wrapDigest(notifier, r.digestWindow, digestFilePath(name))
+}
+
+// all returns all notifiers
+func (r *watchRouting) all() (notifiers []namedNotifier) {
+	notifiers = append(notifiers, r.notifiers...)
+	for _, notifier := range r.inline {
+		notifiers = append(notifiers, notifier)
+	}
+	return
+}
+
+// organizationWatchers returns a watcher for each bank account of the organization
+func organizationWatchers(ctx context.Context, Q qonto.Client, state *watchState, routing *watchRouting) (watchers []*accountWatcher, err error) {
+	organization, err := Q.GetOrganizationContext(ctx, viper.GetString("login"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get organization - %v", err)
+	}
+	found := make(map[string]bool)
+	for _, account := range organization.BankAccounts {
+		found[account.Slug] = true
+		w, err := newAccountWatcher(Q, state, account.Slug, account.Iban, routing)
 		if err != nil {
-			log.Println("ERR: ", err)
-			continue
+			return nil, err
 		}
-		tic = tac
-		// WARNING there is a black hole here !!!
-		tac = time.Now()
-		for _, transaction := range transactions {
-			if transaction.EmittedAt.After(tic) || transaction.SettleAt.After(tic) {
-				go handleNewTransaction(transaction)
-			}
+		watchers = append(watchers, w)
+	}
+	for _, config := range routing.accounts {
+		if !found[config.Slug] {
+			log.Printf("WARN: account %s is defined in config but not found in organization %s", config.Slug, organization.Slug)
 		}
 	}
+	return watchers, nil
 }
 
-// display logs, send email, callwebhook
-func handleNewTransaction(transaction qonto.Transaction) {
-	// Log
-	log.Println(transaction.DisplayInline())
-
-	// send email
-	var auth smtp.Auth
-	if viper.GetString("send-email-to") != "" {
-		// Auth ?
-		if viper.GetString("smtp.user") != "" && viper.GetString("smtp.password") != "" {
-			auth = smtp.PlainAuth("", viper.GetString("smtp.user"), viper.GetString("smtp.password"), viper.GetString("smtp.host"))
+// newAccountWatcher returns a watcher for the account slug, using settings
+// from config if defined, from flags otherwise
+// Events are routed to: log, email and webhook (from flags or account
+// config) and notifiers of the config file (all or those listed in account
+// config).
+func newAccountWatcher(Q qonto.Client, state *watchState, slug, iban string, routing *watchRouting) (*accountWatcher, error) {
+	w := &accountWatcher{
+		client: Q,
+		state:  state,
+		options: qonto.GetTransactionOptions{
+			Slug:   slug,
+			Iban:   iban,
+			Status: parseStatuses(viper.GetStringSlice("statuses")),
+		},
+		notifiers: []namedNotifier{{Notifier: logNotifier{output: viper.GetString("output")}, name: "log"}},
+		alerter:   routing.alerter,
+	}
+	email := viper.GetString("send-email-to")
+	webhook := viper.GetString("webhook")
+	var routes []string
+	for _, config := range routing.accounts {
+		if config.Slug != slug {
+			continue
 		}
-		// let's go
-		msg := []byte(transaction.String())
-		if err := smtp.SendMail(fmt.Sprintf("%s:%s", viper.GetString("smtp.host"), viper.GetString("smtp.port")), auth, viper.GetString("smtp.mailfrom"), []string{viper.GetString("send-email-to")}, msg); err != nil {
-			log.Println("ERR: unable to send mail - ", err)
+		if len(config.Statuses) != 0 {
+			w.options.Status = config.Statuses
 		}
+		if config.Email != "" {
+			email = config.Email
+		}
+		if config.Webhook != "" {
+			webhook = config.Webhook
+		}
+		routes = config.Notifiers
 	}
 
-	// webhook
-	if viper.GetString("webhook") != "" {
-		payload, err := json.Marshal(transaction)
+	if email != "" {
+		notifier, err := routing.email(email)
 		if err != nil {
-			log.Println("ERR: ", err)
-			return
+			return nil, err
 		}
-		resp, err := http.Post(viper.GetString("webhook"), "application/json", bytes.NewBuffer(payload))
+		w.notifiers = append(w.notifiers, notifier)
+	}
+	if webhook != "" {
+		notifier, err := routing.webhook(webhook)
 		if err != nil {
-			log.Println("ERR: ", err)
+			return nil, err
+		}
+		w.notifiers = append(w.notifiers, notifier)
+	}
+
+	if len(routes) == 0 {
+		w.notifiers = append(w.notifiers, routing.notifiers...)
+		return w, nil
+	}
+	for _, route := range routes {
+		found := false
+		for _, notifier := range routing.notifiers {
+			if notifier.name == route {
+				w.notifiers = append(w.notifiers, notifier)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("account %s: notifier %s is not defined", slug, route)
+		}
+	}
+	return w, nil
+}
+
+// stateFilePath returns the path of the watch state file
+// By default it's qonto-watch-state.json in the same path as the binary.
+func stateFilePath() string {
+	if path := viper.GetString("state-file"); path != "" {
+		return path
+	}
+	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "qonto-watch-state.json")
+}
+
+// accountWatcher polls transactions of a bank account
+type accountWatcher struct {
+	client  qonto.Client
+	state   *watchState
+	options qonto.GetTransactionOptions
+	// notifiers[0] is the log notifier
+	notifiers []namedNotifier
+	alerter   *alerter
+}
+
+// run polls the account until ctx is done
+func (w *accountWatcher) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		events, err := w.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("ERR: %s - %v", w.options.Slug, err)
+		}
+		if w.alerter.hasBalanceRules() {
+			account, err := w.bankAccount(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("ERR: %s - unable to get balance - %v", w.options.Slug, err)
+				}
+			} else {
+				events = append(events, w.alerter.balanceEvents(account, time.Now())...)
+			}
+		}
+		// events are queued in durable notifiers (outboxes) before the
+		// state is saved, so they survive a crash
+		others := make([][]namedNotifier, len(events))
+		for i := range events {
+			event := &events[i]
+			notifiers := w.notifiers
+			if w.alerter.enabled() {
+				if event.Alerts == nil {
+					event.Alerts = w.alerter.eventAlerts(*event)
+				}
+				// only events firing a rule are notified, logs excepted
+				if len(event.Alerts) == 0 {
+					notifiers = w.notifiers[:1]
+				}
+			}
+			var durable []namedNotifier
+			durable, others[i] = splitDurable(notifiers)
+			notify(ctx, durable, *event)
+		}
+		if err == nil {
+			if err = w.state.save(); err != nil {
+				log.Println("ERR: unable to save watch state -", err)
+			}
+		}
+		for i, event := range events {
+			wg.Add(1)
+			go func(event Event, notifiers []namedNotifier) {
+				defer wg.Done()
+				notify(ctx, notifiers, event)
+			}(event, others[i])
+		}
+
+		// let's take a little snap
+		select {
+		case <-ctx.Done():
+			log.Printf("stopping watcher for %s, waiting for pending notifications...", w.options.Slug)
+			wg.Wait()
 			return
+		case <-ticker.C:
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			log.Println(fmt.Sprintf("ERR: webhook call has failed - %s ", resp.Status))
+	}
+}
+
+// poll fetches transactions updated since last poll and returns the
+// events detected
+func (w *accountWatcher) poll(ctx context.Context) ([]Event, error) {
+	pollTime := time.Now()
+	options := w.options
+	options.PerPage = 100
+	options.SortBy = "updated_at:asc"
+	// on first poll (no state yet) all transactions are fetched to take
+	// a snapshot of the account
+	if lastPoll, ok := w.state.lastPoll(options.Slug); ok {
+		options.UpdatedAtFrom = lastPoll.Add(-watchPollMargin)
+	}
+	var transactions []qonto.Transaction
+	err := w.client.ListAllTransactionsContext(ctx, options, func(page []qonto.Transaction, meta qonto.TransactionsMeta) error {
+		transactions = append(transactions, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w.state.update(options.Slug, transactions, pollTime), nil
+}
+
+// bankAccount returns the watched bank account (with its balances)
+func (w *accountWatcher) bankAccount(ctx context.Context) (qonto.BankAccount, error) {
+	organization, err := w.client.GetOrganizationContext(ctx, viper.GetString("login"))
+	if err != nil {
+		return qonto.BankAccount{}, err
+	}
+	for _, account := range organization.BankAccounts {
+		if account.Slug == w.options.Slug {
+			return account, nil
 		}
 	}
+	return qonto.BankAccount{}, fmt.Errorf("account not found in organization %s", organization.Slug)
 }
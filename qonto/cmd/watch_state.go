@@ -0,0 +1,254 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	qonto "github.com/toorop/go-qonto"
+)
+
+// EventType is the type of change detected by watch on a transaction
+type EventType string
+
+// Event types
+const (
+	EventCreated       EventType = "created"
+	EventStatusChanged EventType = "status_changed"
+	EventSettled       EventType = "settled"
+	EventReversed      EventType = "reversed"
+	// EventUpdated is sent when a transaction changes without a status
+	// change (amounts,...)
+	EventUpdated EventType = "updated"
+	// EventBalanceBelow is sent when the authorized balance of an account
+	// drops below the threshold of a rule
+	EventBalanceBelow EventType = "balance_below"
+)
+
+// Event is a change detected by watch on a transaction
+type Event struct {
+	Type EventType
+	// Account is the slug of the bank account
+	Account     string
+	Transaction qonto.Transaction
+	// PreviousStatus is the status of the transaction before the change
+	// (empty for created events)
+	PreviousStatus qonto.Status
+	// DetectedAt is the time watch has detected the change
+	DetectedAt time.Time
+	// Digest is set for digest events only (Transaction is empty)
+	Digest *Digest
+	// BankAccount is set for balance events only (Transaction is empty)
+	BankAccount *qonto.BankAccount
+	// Alerts are the rules fired by the event
+	Alerts []Alert
+}
+
+// summary returns a one line description of the event
+func (e *Event) summary() string {
+	out := ""
+	for _, alert := range e.Alerts {
+		out += alert.String() + " "
+	}
+	switch {
+	case e.Digest != nil:
+		out += fmt.Sprintf("%d event(s)", len(e.Digest.Events))
+	case e.BankAccount != nil:
+		out += fmt.Sprintf("%s - authorized balance: %s", e.BankAccount.Slug, e.BankAccount.AuthorizedBalanceMoney())
+	default:
+		out += e.Transaction.DisplayInline()
+	}
+	return out
+}
+
+// watchState is the snapshot of seen transactions, persisted in a file
+// so watch can be restarted without losing or duplicating events
+type watchState struct {
+	mu sync.Mutex
+	// saveMu serializes saves, so an older snapshot can't be renamed over
+	// a newer one
+	saveMu   sync.Mutex
+	path     string
+	Accounts map[string]*accountState `json:"accounts"`
+}
+
+// accountState is the snapshot of seen transactions for a bank account
+type accountState struct {
+	// LastPoll is the start time of the last successful poll
+	LastPoll     time.Time                  `json:"last_poll"`
+	Transactions map[string]seenTransaction `json:"transactions"`
+}
+
+// seenTransaction is what we keep about a transaction to detect changes
+type seenTransaction struct {
+	Status  qonto.Status `json:"status"`
+	Settled bool         `json:"settled"`
+	Hash    string       `json:"hash"`
+	// LastSeen is the time of the last poll returning the transaction
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// newSeenTransaction returns the snapshot of a transaction
+func newSeenTransaction(transaction qonto.Transaction) seenTransaction {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s|%d|%d|%s|%s", transaction.Status, transaction.AmountCents, transaction.LocalAmountCents,
+		transaction.SettleAt.UTC().Format(qonto.ISO8601), transaction.Side)
+	return seenTransaction{
+		Status:  transaction.Status,
+		Settled: transaction.SettleAt.Valid(),
+		Hash:    hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// loadWatchState loads state from path, an empty state is returned if
+// the file doesn't exist
+func loadWatchState(path string) (*watchState, error) {
+	state := &watchState{
+		path:     path,
+		Accounts: make(map[string]*accountState),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("unable to decode state file %s: %v", path, err)
+	}
+	if state.Accounts == nil {
+		state.Accounts = make(map[string]*accountState)
+	}
+	return state, nil
+}
+
+// save writes state on disk (atomically)
+func (s *watchState) save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	data, err := json.Marshal(s)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// lastPoll returns the start time of the last successful poll of account
+// and false if account has never been polled
+func (s *watchState) lastPoll(account string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.Accounts[account]
+	if !ok {
+		return time.Time{}, false
+	}
+	return a.LastPoll, true
+}
+
+// update records transactions of account polled at pollTime and returns
+// detected events. On the first poll of an account, transactions are
+// recorded without events.
+func (s *watchState) update(account string, transactions []qonto.Transaction, pollTime time.Time) (events []Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, known := s.Accounts[account]
+	if !known {
+		a = &accountState{Transactions: make(map[string]seenTransaction)}
+		s.Accounts[account] = a
+	}
+	now := time.Now()
+	for _, transaction := range transactions {
+		current := newSeenTransaction(transaction)
+		current.LastSeen = pollTime
+		previous, seen := a.Transactions[transaction.ID]
+		a.Transactions[transaction.ID] = current
+		if !known || (seen && previous.Hash == current.Hash) {
+			continue
+		}
+		event := Event{
+			Account:     account,
+			Transaction: transaction,
+			DetectedAt:  now,
+		}
+		switch {
+		case !seen:
+			event.Type = EventCreated
+		case previous.Status != current.Status && current.Status.IsReversed():
+			event.Type = EventReversed
+		case (previous.Status != current.Status && current.Status.IsSettled()) || (!previous.Settled && current.Settled):
+			event.Type = EventSettled
+		case previous.Status != current.Status:
+			event.Type = EventStatusChanged
+		default:
+			event.Type = EventUpdated
+		}
+		if seen {
+			event.PreviousStatus = previous.Status
+		}
+		events = append(events, event)
+	}
+	a.LastPoll = pollTime
+	a.prune(pollTime)
+	return events
+}
+
+// prune drops transactions in a final status (settled, declined or
+// reversed) which have not been returned by polls for watchPollMargin plus
+// watchStateRetention, so the state doesn't grow forever. If such a
+// transaction is updated later, it's notified as created.
+func (a *accountState) prune(now time.Time) {
+	for id, t := range a.Transactions {
+		// saved before last_seen was recorded
+		if t.LastSeen.IsZero() {
+			t.LastSeen = now
+			a.Transactions[id] = t
+			continue
+		}
+		final := t.Status.IsSettled() || t.Status.IsDeclined() || t.Status.IsReversed()
+		if final && now.Sub(t.LastSeen) > watchPollMargin+watchStateRetention {
+			delete(a.Transactions, id)
+		}
+	}
+}
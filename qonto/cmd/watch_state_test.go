@@ -0,0 +1,168 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+func testTransaction(id string, status qonto.Status, settledAt string) qonto.Transaction {
+	transaction := qonto.Transaction{ID: id, AmountCents: 1000, Currency: "EUR", Side: qonto.SideDebit, Status: status}
+	if settledAt != "" {
+		transaction.SettleAt, _ = qonto.ParseQtime(settledAt)
+	}
+	return transaction
+}
+
+func TestWatchStateUpdate(t *testing.T) {
+	const settledAt = "2018-01-18T06:46:12.000Z"
+	pending := testTransaction("t1", qonto.StatusPending, "")
+	amended := pending
+	amended.AmountCents = 1200
+
+	for _, test := range []struct {
+		name     string
+		previous *qonto.Transaction
+		current  qonto.Transaction
+		// expected event, none if empty
+		event          EventType
+		previousStatus qonto.Status
+	}{
+		{"created", nil, pending, EventCreated, ""},
+		{"unchanged", &pending, pending, "", ""},
+		{"settled", &pending, testTransaction("t1", qonto.StatusCompleted, settledAt), EventSettled, qonto.StatusPending},
+		{"settlement date set", func() *qonto.Transaction {
+			t := testTransaction("t1", qonto.StatusCompleted, "")
+			return &t
+		}(), testTransaction("t1", qonto.StatusCompleted, settledAt), EventSettled, qonto.StatusCompleted},
+		{"reversed", &pending, testTransaction("t1", qonto.StatusReversed, ""), EventReversed, qonto.StatusPending},
+		{"declined", &pending, testTransaction("t1", qonto.StatusDeclined, ""), EventStatusChanged, qonto.StatusPending},
+		{"amount changed", &pending, amended, EventUpdated, qonto.StatusPending},
+	} {
+		state, err := loadWatchState(filepath.Join(t.TempDir(), "state.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// first run: snapshot without events
+		var snapshot []qonto.Transaction
+		if test.previous != nil {
+			snapshot = append(snapshot, *test.previous)
+		}
+		firstPoll := time.Date(2018, 1, 18, 8, 0, 0, 0, time.UTC)
+		assert.Empty(t, state.update("acc-1", snapshot, firstPoll), test.name)
+		lastPoll, ok := state.lastPoll("acc-1")
+		assert.True(t, ok, test.name)
+		assert.Equal(t, firstPoll, lastPoll, test.name)
+
+		events := state.update("acc-1", []qonto.Transaction{test.current}, firstPoll.Add(time.Minute))
+		if test.event == "" {
+			assert.Empty(t, events, test.name)
+			continue
+		}
+		if assert.Len(t, events, 1, test.name) {
+			assert.Equal(t, test.event, events[0].Type, test.name)
+			assert.Equal(t, test.previousStatus, events[0].PreviousStatus, test.name)
+			assert.Equal(t, "acc-1", events[0].Account, test.name)
+			assert.Equal(t, test.current, events[0].Transaction, test.name)
+		}
+		// the change is recorded
+		assert.Empty(t, state.update("acc-1", []qonto.Transaction{test.current}, firstPoll.Add(2*time.Minute)), test.name)
+	}
+
+	// first run of an account is per account
+	state, _ := loadWatchState(filepath.Join(t.TempDir(), "state.json"))
+	_, ok := state.lastPoll("acc-1")
+	assert.False(t, ok)
+	assert.Empty(t, state.update("acc-1", []qonto.Transaction{pending}, time.Now()))
+	assert.Empty(t, state.update("acc-2", []qonto.Transaction{pending}, time.Now()))
+	assert.Len(t, state.update("acc-2", []qonto.Transaction{testTransaction("t2", qonto.StatusPending, "")}, time.Now()), 1)
+}
+
+func TestWatchStateSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	state, err := loadWatchState(path)
+	assert.NoError(t, err)
+	pollTime := time.Date(2018, 1, 18, 8, 0, 0, 0, time.UTC)
+	state.update("acc-1", []qonto.Transaction{testTransaction("t1", qonto.StatusPending, "")}, pollTime)
+	assert.NoError(t, state.save())
+
+	// no temporary file left
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	// reload from disk: known transactions don't trigger events
+	reloaded, err := loadWatchState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, state.Accounts, reloaded.Accounts)
+	lastPoll, ok := reloaded.lastPoll("acc-1")
+	assert.True(t, ok)
+	assert.True(t, pollTime.Equal(lastPoll))
+	events := reloaded.update("acc-1", []qonto.Transaction{
+		testTransaction("t1", qonto.StatusCompleted, "2018-01-18T06:46:12.000Z"),
+		testTransaction("t2", qonto.StatusPending, ""),
+	}, pollTime.Add(time.Minute))
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, EventSettled, events[0].Type)
+		assert.Equal(t, EventCreated, events[1].Type)
+	}
+
+	// invalid state file
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	_, err = loadWatchState(path)
+	assert.Error(t, err)
+}
+
+func TestWatchStatePrune(t *testing.T) {
+	state, _ := loadWatchState(filepath.Join(t.TempDir(), "state.json"))
+	start := time.Date(2018, 1, 18, 8, 0, 0, 0, time.UTC)
+	state.update("acc-1", []qonto.Transaction{
+		testTransaction("completed", qonto.StatusCompleted, "2018-01-18T06:46:12.000Z"),
+		testTransaction("declined", qonto.StatusDeclined, ""),
+		testTransaction("pending", qonto.StatusPending, ""),
+		testTransaction("returned", qonto.StatusCompleted, "2018-01-18T06:46:12.000Z"),
+	}, start)
+	// states saved before last_seen was recorded
+	legacy := state.Accounts["acc-1"].Transactions["completed"]
+	legacy.LastSeen = time.Time{}
+	state.Accounts["acc-1"].Transactions["legacy"] = legacy
+
+	// within retention
+	returned := []qonto.Transaction{testTransaction("returned", qonto.StatusCompleted, "2018-01-18T06:46:12.000Z")}
+	end := start.Add(watchPollMargin + watchStateRetention)
+	state.update("acc-1", returned, end)
+	assert.Len(t, state.Accounts["acc-1"].Transactions, 5)
+	assert.Equal(t, end, state.Accounts["acc-1"].Transactions["legacy"].LastSeen)
+
+	// final transactions not returned anymore are dropped
+	state.update("acc-1", returned, end.Add(time.Minute))
+	var ids []string
+	for id := range state.Accounts["acc-1"].Transactions {
+		ids = append(ids, id)
+	}
+	assert.ElementsMatch(t, []string{"pending", "returned", "legacy"}, ids)
+}
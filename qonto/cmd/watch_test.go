@@ -0,0 +1,104 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	qonto "github.com/toorop/go-qonto"
+)
+
+// newTestAPI returns a Qonto API stand-in for the organization my-orga-42
+// with two bank accounts, each call to /transactions returns a new
+// transaction of the requested account
+func newTestAPI(t *testing.T) (qonto.Client, *httptest.Server) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/organizations/":
+			fmt.Fprint(w, `{"organization":{"slug":"my-orga-42","bank_accounts":[{"slug":"acc-1","iban":"IBAN1","currency":"EUR"},{"slug":"acc-2","iban":"IBAN2","currency":"EUR"}]}}`)
+		case "/transactions":
+			id := fmt.Sprintf("%s-transaction-%d", r.URL.Query().Get("slug"), atomic.AddInt64(&calls, 1))
+			fmt.Fprintf(w, `{"transactions":[{"transaction_id":%q,"amount_cents":1000,"currency":"EUR","side":"debit","status":"pending"}],"meta":{"current_page":1,"total_pages":1,"total_count":1,"per_page":100}}`, id)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return qonto.New("", "secret", qonto.WithEndpoint(ts.URL)), ts
+}
+
+func TestConcurrentWatchers(t *testing.T) {
+	Q, _ := newTestAPI(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := loadWatchState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchers, err := organizationWatchers(context.Background(), Q, state, &watchRouting{inline: make(map[string]namedNotifier)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, watchers, 2) {
+		return
+	}
+	assert.Equal(t, "acc-1", watchers[0].options.Slug)
+	assert.Equal(t, "IBAN2", watchers[1].options.Iban)
+
+	// watchers share the state: polls and saves run concurrently
+	const polls = 20
+	var wg sync.WaitGroup
+	for _, w := range watchers {
+		wg.Add(1)
+		go func(w *accountWatcher) {
+			defer wg.Done()
+			for i := 0; i < polls; i++ {
+				events, err := w.poll(context.Background())
+				assert.NoError(t, err)
+				// first poll is the snapshot
+				if i == 0 {
+					assert.Empty(t, events)
+				} else {
+					assert.Len(t, events, 1)
+				}
+				assert.NoError(t, w.state.save())
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// the last save holds the last snapshot of both accounts
+	reloaded, err := loadWatchState(path)
+	assert.NoError(t, err)
+	for _, slug := range []string{"acc-1", "acc-2"} {
+		if assert.Contains(t, reloaded.Accounts, slug) {
+			assert.Len(t, reloaded.Accounts[slug].Transactions, polls)
+		}
+	}
+}
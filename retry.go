@@ -0,0 +1,205 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy defines how the client retries failed requests
+// Only idempotent requests (GET, HEAD, OPTIONS, PUT, DELETE) are retried,
+// on network errors, 429 Too Many Requests and 5xx (500, 502, 503, 504)
+// responses.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts (first one included),
+	// a value lower than 2 disables retries
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry, it's doubled on
+	// each retry (with jitter)
+	MinBackoff time.Duration
+	// MaxBackoff is the max wait between two attempts
+	// Retry-After header returned by the API is honored even if greater.
+	MaxBackoff time.Duration
+	// OnRetry, if not nil, is called before each retry
+	OnRetry func(event RetryEvent)
+}
+
+// RetryEvent describes a retry, it's passed to RetryPolicy.OnRetry
+type RetryEvent struct {
+	// Attempt is the number of the attempt which has failed (starting at 1)
+	Attempt int
+	Method  string
+	URL     string
+	// StatusCode is the HTTP status of the failed attempt, 0 on network error
+	StatusCode int
+	// Err is the network error, nil if a response was returned
+	Err error
+	// Wait is the time the client will wait before the next attempt
+	Wait time.Duration
+}
+
+// DefaultRetryPolicy is a sensible retry policy: 4 attempts, exponential
+// backoff from 500ms to 30s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+}
+
+// WithRetryPolicy enables retries on transient errors
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = &policy
+	}
+}
+
+// isIdempotent returns true if req can safely be sent again
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// shouldRetry returns true if the attempt has failed with a transient error
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		// do not retry if the caller has given up
+		return req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before the next attempt
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+	wait := p.MinBackoff
+	for i := 1; i < attempt && wait < math.MaxInt64/2; i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	// jitter: wait between wait/2 and wait
+	if half := int64(wait / 2); half > 0 {
+		wait = time.Duration(half + rand.Int63n(half+1))
+	}
+	return wait
+}
+
+// parseRetryAfter parses Retry-After header (seconds or HTTP date)
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// doWithRetry sends req, retrying it according to the client retry policy
+func (c *Client) doWithRetry(req *http.Request) (*http.Response, error) {
+	policy := c.retry
+	if policy == nil || policy.MaxAttempts < 2 || !isIdempotent(req) {
+		return c.send(req)
+	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := c.send(req)
+		if attempt >= policy.MaxAttempts || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		wait := policy.backoff(attempt, resp)
+		event := RetryEvent{
+			Attempt: attempt,
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Err:     err,
+			Wait:    wait,
+		}
+		if resp != nil {
+			event.StatusCode = resp.StatusCode
+			// drain body to reuse the connection
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(event)
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send waits for the rate limiter (if any) then sends req
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return c.client.Do(req)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"time"
+)
+
+// Statement is a bank statement: transactions of a bank account settled
+// during a period, used by statement exports (OFX,...)
+type Statement struct {
+	Account BankAccount
+	// From and To are the period of the statement
+	From time.Time
+	To   time.Time
+	// Transactions of the period, completed ones are booked
+	Transactions []Transaction
+	// ClosingBalance is the booked balance at To (Account balance if not
+	// set)
+	ClosingBalance Money
+	// CreatedAt is the creation time of the statement (now if not set)
+	CreatedAt time.Time
+}
+
+// Currency returns the currency of the statement
+func (s *Statement) Currency() string {
+	if s.ClosingBalance.Currency != "" {
+		return s.ClosingBalance.Currency
+	}
+	return NewMoney(0, s.Account.Currency).Currency
+}
+
+// Closing returns the booked balance at the end of the period
+func (s *Statement) Closing() Money {
+	if s.ClosingBalance.Currency == "" {
+		return s.Account.BalanceMoney()
+	}
+	return s.ClosingBalance
+}
+
+// Opening returns the booked balance at the beginning of the period: the
+// closing balance minus completed transactions of the statement
+func (s *Statement) Opening() (Money, error) {
+	opening := s.Closing()
+	for _, t := range s.Booked() {
+		var err error
+		if opening, err = opening.Sub(t.SignedMoney()); err != nil {
+			return opening, err
+		}
+	}
+	return opening, nil
+}
+
+// Booked returns completed transactions of the statement
+func (s *Statement) Booked() (transactions []Transaction) {
+	for _, t := range s.Transactions {
+		if t.Status == StatusCompleted {
+			transactions = append(transactions, t)
+		}
+	}
+	return
+}
+
+// createdAt returns the creation time of the statement
+func (s *Statement) createdAt() time.Time {
+	if s.CreatedAt.IsZero() {
+		return time.Now()
+	}
+	return s.CreatedAt
+}
+
+// bookingDate returns the booking date of t (settlement date, or emission
+// date if t is not settled)
+func bookingDate(t Transaction) time.Time {
+	if t.SettleAt.Valid() {
+		return t.SettleAt.Time
+	}
+	return t.EmittedAt.Time
+}
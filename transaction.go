@@ -21,8 +21,11 @@
 package qonto
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -34,41 +37,112 @@ const (
 
 // Transaction represents a qonto transaction model
 type Transaction struct {
-	ID               string  `json:"transaction_id"`
-	Amount           float64 `json:"amount"`
-	AmountCents      uint64  `json:"amount_cents"`
-	LocalAmount      float64 `json:"local_amount"`
-	LocalAmountCents uint64  `json:"local_amount_cents"`
-	Side             string  `json:"side"`           // credit | debit
-	OperationType    string  `json:"operation_type"` // transfert | card | direct_debit | income | qonto_fee
-	Currency         string  `json:"currency"`       // ISO 4217
-	LocalCurrency    string  `json:"local_currency"` // ISO 4217
-	SettleAt         Qtime   `json:"settled_at"`
-	EmittedAt        Qtime   `json:"emitted_at"`
-	Status           string  `json:"status"`
-	Note             string  `json:"note"`
-	Label            string  `json:"label"`
+	ID               string        `json:"transaction_id"`
+	Amount           float64       `json:"amount"`
+	AmountCents      uint64        `json:"amount_cents"`
+	LocalAmount      float64       `json:"local_amount"`
+	LocalAmountCents uint64        `json:"local_amount_cents"`
+	Side             Side          `json:"side"`
+	OperationType    OperationType `json:"operation_type"`
+	Currency         string        `json:"currency"`       // ISO 4217
+	LocalCurrency    string        `json:"local_currency"` // ISO 4217
+	SettleAt         Qtime         `json:"settled_at"`
+	EmittedAt        Qtime         `json:"emitted_at"`
+	Status           Status        `json:"status"`
+	Note             string        `json:"note"`
+	Label            string        `json:"label"`
 }
 
 // Qtime is time formated as returned by Qonto API
 // ISO8601 yyyy-MM-dd'T'HH:mm:ss.SSSZ
+// A JSON null is decoded as the zero time (see Valid).
 type Qtime struct {
 	time.Time
 }
 
+// qtimeLayouts are the layouts accepted by Qtime unmarshaler
+var qtimeLayouts = []string{
+	ISO8601,
+	time.RFC3339Nano, // with or without fractional seconds, Z or offset
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02",
+}
+
+// ParseQtime parses a time returned by Qonto API
+func ParseQtime(value string) (t Qtime, err error) {
+	for _, layout := range qtimeLayouts {
+		if t.Time, err = time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("unable to parse time %q", value)
+}
+
+// Valid returns true if t is set (not null)
+func (t Qtime) Valid() bool {
+	return !t.IsZero()
+}
+
 // UnmarshalJSON is the Qtime unmarshaler
 func (t *Qtime) UnmarshalJSON(b []byte) (err error) {
-	b = b[1 : len(b)-1]
-	t.Time, err = time.Parse(ISO8601, string(b))
+	if string(b) == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	var value string
+	if err = json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	if value == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	*t, err = ParseQtime(value)
 	return err
 }
 
+// MarshalJSON is the Qtime marshaler, zero time is marshaled as null
+func (t Qtime) MarshalJSON() ([]byte, error) {
+	if !t.Valid() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.UTC().Format(ISO8601))
+}
+
+// Money returns transaction amount as Money (always positive, see Side)
+func (t Transaction) Money() Money {
+	return NewMoney(int64(t.AmountCents), t.Currency)
+}
+
+// LocalMoney returns transaction amount in local currency as Money
+func (t Transaction) LocalMoney() Money {
+	return NewMoney(int64(t.LocalAmountCents), t.LocalCurrency)
+}
+
+// SignedMoney returns transaction amount as Money, negative for debits
+func (t Transaction) SignedMoney() Money {
+	if t.Side.IsDebit() {
+		return t.Money().Neg()
+	}
+	return t.Money()
+}
+
+// SignedLocalMoney returns transaction local amount as Money, negative for
+// debits
+func (t Transaction) SignedLocalMoney() Money {
+	if t.Side.IsDebit() {
+		return t.LocalMoney().Neg()
+	}
+	return t.LocalMoney()
+}
+
 func (t *Transaction) String() string {
 	return fmt.Sprintf(`
 		ID: %s
-		Amount: %f
+		Amount: %s
 		Amount (cts): %d
-		Local amount: %f
+		Local amount: %s
 		Local amount (cts): %d
 		Side: %s
 		Operation type: %s 
@@ -79,7 +153,7 @@ func (t *Transaction) String() string {
 		Status: %s
 		Note: %s
 		Label: %s
-		`, t.ID, t.Amount, t.AmountCents, t.LocalAmount, t.LocalAmountCents, t.Side, t.OperationType, t.Currency, t.LocalCurrency, t.EmittedAt, t.SettleAt, t.Status, t.Note, t.Label)
+		`, t.ID, t.Money(), t.AmountCents, t.LocalMoney(), t.LocalAmountCents, t.Side, t.OperationType, t.Currency, t.LocalCurrency, t.EmittedAt, t.SettleAt, t.Status, t.Note, t.Label)
 }
 
 // DisplayInline return transaction as one line sting
@@ -91,12 +165,39 @@ func (t *Transaction) DisplayInline() string {
 // struct and tools for HTTP request & response
 
 // GetTransactionOptions -> options for GetTransactions
+// Zero values are not sent to the API. Enum values unknown to this package
+// are rejected.
 type GetTransactionOptions struct {
-	Slug        string
-	Iban        string
-	Status      []string
-	CurrentPage uint16
-	PerPage     uint16
+	Slug          string
+	Iban          string
+	Status        []Status
+	SettledAtFrom time.Time
+	SettledAtTo   time.Time
+	UpdatedAtFrom time.Time
+	UpdatedAtTo   time.Time
+	Side          Side
+	OperationType []OperationType
+	SortBy        string // settled_at:asc | settled_at:desc | updated_at:asc | updated_at:desc
+	CurrentPage   uint16
+	PerPage       uint16
+}
+
+var (
+	transactionStatuses       = []string{string(StatusPending), string(StatusReversed), string(StatusDeclined), string(StatusCompleted)}
+	transactionSides          = []string{string(SideCredit), string(SideDebit)}
+	transactionOperationTypes = []string{string(OperationTypeTransfer), string(OperationTypeCard), string(OperationTypeDirectDebit), string(OperationTypeIncome),
+		string(OperationTypeQontoFee), string(OperationTypeCheque), string(OperationTypeRecall), string(OperationTypeSwiftIncome)}
+	transactionSortBy = []string{"settled_at:asc", "settled_at:desc", "updated_at:asc", "updated_at:desc"}
+)
+
+// inEnum returns true if value is in enum
+func inEnum(value string, enum []string) bool {
+	for _, v := range enum {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 func (o *GetTransactionOptions) isValid() (bool, error) {
@@ -109,20 +210,86 @@ func (o *GetTransactionOptions) isValid() (bool, error) {
 	if o.Iban == "" {
 		return false, errors.New("parameter Iban is required")
 	}
-	// TODO (eventualy) check []status in enum (pending, reversed, declined, completed)
+	// enums
+	for _, status := range o.Status {
+		if !status.IsKnown() {
+			return false, fmt.Errorf("parameter Status: invalid value %q (expected one of %s)", status, strings.Join(transactionStatuses, ", "))
+		}
+	}
+	if o.Side != "" && !o.Side.IsKnown() {
+		return false, fmt.Errorf("parameter Side: invalid value %q (expected one of %s)", o.Side, strings.Join(transactionSides, ", "))
+	}
+	for _, operationType := range o.OperationType {
+		if !operationType.IsKnown() {
+			return false, fmt.Errorf("parameter OperationType: invalid value %q (expected one of %s)", operationType, strings.Join(transactionOperationTypes, ", "))
+		}
+	}
+	if o.SortBy != "" && !inEnum(o.SortBy, transactionSortBy) {
+		return false, fmt.Errorf("parameter SortBy: invalid value %q (expected one of %s)", o.SortBy, strings.Join(transactionSortBy, ", "))
+	}
+	// ranges
+	if !o.SettledAtFrom.IsZero() && !o.SettledAtTo.IsZero() && o.SettledAtTo.Before(o.SettledAtFrom) {
+		return false, errors.New("parameter SettledAtTo must be after SettledAtFrom")
+	}
+	if !o.UpdatedAtFrom.IsZero() && !o.UpdatedAtTo.IsZero() && o.UpdatedAtTo.Before(o.UpdatedAtFrom) {
+		return false, errors.New("parameter UpdatedAtTo must be after UpdatedAtFrom")
+	}
 	return true, nil
 
 }
 
+// values returns options encoded as query parameters
+func (o *GetTransactionOptions) values() url.Values {
+	query := url.Values{}
+	query.Set("slug", o.Slug)
+	query.Set("iban", o.Iban)
+	for _, status := range o.Status {
+		query.Add("status[]", string(status))
+	}
+	setTime := func(key string, t time.Time) {
+		if !t.IsZero() {
+			query.Set(key, t.UTC().Format(ISO8601))
+		}
+	}
+	setTime("settled_at_from", o.SettledAtFrom)
+	setTime("settled_at_to", o.SettledAtTo)
+	setTime("updated_at_from", o.UpdatedAtFrom)
+	setTime("updated_at_to", o.UpdatedAtTo)
+	if o.Side != "" {
+		query.Set("side", string(o.Side))
+	}
+	for _, operationType := range o.OperationType {
+		query.Add("operation_type[]", string(operationType))
+	}
+	if o.SortBy != "" {
+		query.Set("sort_by", o.SortBy)
+	}
+	if o.CurrentPage != 0 {
+		query.Set("current_page", strconv.FormatUint(uint64(o.CurrentPage), 10))
+	}
+	if o.PerPage != 0 {
+		query.Set("per_page", strconv.FormatUint(uint64(o.PerPage), 10))
+	}
+	return query
+}
+
+// TransactionsMeta holds the pagination metadata returned by GET /transactions
+type TransactionsMeta struct {
+	CurrentPage uint16 `json:"current_page"`
+	NextPage    uint16 `json:"next_page"`
+	PrevPage    uint16 `json:"prev_page"`
+	TotalPages  uint16 `json:"total_pages"`
+	TotalCount  uint32 `json:"total_count"`
+	PerPage     uint16 `json:"per_page"`
+}
+
+// HasNextPage returns true if there is a page after the current one
+func (m TransactionsMeta) HasNextPage() bool {
+	return m.NextPage != 0
+}
+
 // response to GET /transactions
 type getTransactionResponse struct {
-	Transactions []Transaction `json:"transactions"`
-	Meta         struct {
-		CurrentPage uint16 `json:"current_page"`
-		NextPage    uint16 `json:"next_page"`
-		PrevPage    uint16 `json:"prev_page"`
-		TotalPage   uint16 `json:"total_page"`
-		TotalCount  uint32 `json:"total_count"`
-		PerPage     uint16 `json:"per_page"`
-	} `json:"meta"`
+	Transactions []Transaction    `json:"transactions"`
+	Meta         TransactionsMeta `json:"meta"`
 }
@@ -0,0 +1,92 @@
+// Copyright © 2018 Stéphane Depierrepont
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package qonto
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQtimeUnmarshal(t *testing.T) {
+	expected := time.Date(2018, 1, 18, 6, 45, 57, 0, time.UTC)
+	for _, value := range []string{
+		`"2018-01-18T06:45:57.000Z"`,
+		`"2018-01-18T06:45:57Z"`,
+		`"2018-01-18T07:45:57+01:00"`,
+		`"2018-01-18T07:45:57.000+01:00"`,
+	} {
+		var qt Qtime
+		assert.NoError(t, json.Unmarshal([]byte(value), &qt), value)
+		assert.True(t, expected.Equal(qt.Time), value)
+		assert.True(t, qt.Valid())
+	}
+
+	var qt Qtime
+	assert.NoError(t, json.Unmarshal([]byte(`null`), &qt))
+	assert.False(t, qt.Valid())
+	assert.Error(t, json.Unmarshal([]byte(`"yesterday"`), &qt))
+}
+
+func TestQtimeMarshal(t *testing.T) {
+	tx := Transaction{
+		ID:        "tx-1",
+		EmittedAt: Qtime{time.Date(2018, 1, 18, 7, 45, 58, 0, time.FixedZone("CET", 3600))},
+	}
+	b, err := json.Marshal(tx)
+	assert.NoError(t, err)
+	var raw map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &raw))
+	assert.Equal(t, "2018-01-18T06:45:58.000Z", raw["emitted_at"])
+	assert.Nil(t, raw["settled_at"])
+
+	// round trip
+	var decoded Transaction
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.True(t, tx.EmittedAt.Equal(decoded.EmittedAt.Time))
+	assert.False(t, decoded.SettleAt.Valid())
+}
+
+func TestEnums(t *testing.T) {
+	var tx Transaction
+	assert.NoError(t, json.Unmarshal([]byte(`{"side":"debit","operation_type":"card","status":"completed"}`), &tx))
+	assert.True(t, tx.Side.IsDebit())
+	assert.False(t, tx.Side.IsCredit())
+	assert.True(t, tx.OperationType.IsCard())
+	assert.True(t, tx.Status.IsSettled())
+	assert.True(t, tx.Side.IsKnown() && tx.OperationType.IsKnown() && tx.Status.IsKnown())
+
+	// unknown values are preserved
+	assert.NoError(t, json.Unmarshal([]byte(`{"side":null,"operation_type":"crypto","status":"frozen"}`), &tx))
+	assert.Equal(t, "unknown", tx.Side.String())
+	assert.False(t, tx.Side.IsKnown())
+	assert.Equal(t, OperationType("crypto"), tx.OperationType)
+	assert.Equal(t, "crypto", tx.OperationType.String())
+	assert.False(t, tx.OperationType.IsKnown())
+	assert.Equal(t, "frozen", tx.Status.String())
+	assert.False(t, tx.Status.IsSettled())
+
+	b, err := json.Marshal(tx)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"operation_type":"crypto"`)
+}